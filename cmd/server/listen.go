@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strings"
+)
+
+// listen listens on addr, which is a TCP address unless it starts with unix:,
+// in which case the rest is the path to a unix socket. Closing the listener
+// removes the socket file.
+func listen(addr string) (net.Listener, error) {
+	path := strings.TrimPrefix(addr, "unix:")
+	if path == addr {
+		return net.Listen("tcp", addr)
+	}
+
+	// A socket left behind by a server that didn't shut down cleanly would
+	// stop us from listening
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListen(t *testing.T) {
+	type testCase struct {
+		name    string
+		addr    func(dir string) string
+		network string
+	}
+
+	cases := []testCase{
+		testCase{
+			name:    "tcp",
+			addr:    func(dir string) string { return "127.0.0.1:0" },
+			network: "tcp",
+		},
+		testCase{
+			name:    "unix socket",
+			addr:    func(dir string) string { return "unix:" + filepath.Join(dir, "app.sock") },
+			network: "unix",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "listen")
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			defer os.RemoveAll(dir)
+
+			ln, err := listen(c.addr(dir))
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			server := &http.Server{
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte("unit-test"))
+				}),
+			}
+			go server.Serve(ln)
+
+			// Dial whatever we are listening on, whatever the url says
+			client := &http.Client{
+				Transport: &http.Transport{
+					DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+						var d net.Dialer
+						return d.DialContext(ctx, ln.Addr().Network(), ln.Addr().String())
+					},
+				},
+			}
+			resp, err := client.Get("http://unit-test/health")
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if got := ln.Addr().Network(); got != c.network {
+				t.Errorf("expected networks to match; got: %v, want: %v", got, c.network)
+			}
+			if string(body) != "unit-test" {
+				t.Errorf("expected bodies to match; got: %q, want: %q", body, "unit-test")
+			}
+
+			server.Shutdown(context.Background())
+			if c.network == "unix" {
+				if _, err := os.Stat(ln.Addr().String()); !os.IsNotExist(err) {
+					t.Errorf("expected the socket to be removed on shutdown; got: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestListenStaleSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "listen")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.sock")
+
+	// Leave the socket file behind, as a crashed server would
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listen("unix:" + path)
+	if err != nil {
+		t.Fatalf("expected the stale socket to be replaced; got: %v", err)
+	}
+	ln.Close()
+}
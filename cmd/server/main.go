@@ -8,24 +8,91 @@ import (
 	"syscall"
 	"time"
 
+	rvAuth "github.com/RedVentures/sdk-go/auth"
+	"github.com/coulterac/go-api/internal/api"
 	"github.com/go-kit/kit/log"
 	"github.com/kelseyhightower/envconfig"
-	newrelic "github.com/newrelic/go-agent"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var build = "local"
 
 type config struct {
-	Addr            string        `default:":8080" required:"true" split_words:"true"`
-	MetricsAddr     string        `default:":5000" required:"true" split_words:"true"`
-	NewRelicApiKey  string        `default:"xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx" required:"true" split_words:"true"`
-	NewRelicAppName string        `default:"go-api-local" required:"true" split_words:"true"`
-	ReadTimeout     time.Duration `default:"30s" required:"true" split_words:"true"`
-	WriteTimeout    time.Duration `default:"30s" required:"true" split_words:"true"`
+	AccessLogFormat               string        `split_words:"true"`
+	AccessLogSampleRate           int           `default:"1" split_words:"true"`
+	Addr                          string        `default:":8080" required:"true" split_words:"true"`
+	AdminToken                    string        `split_words:"true"`
+	AuthBreakerCooldown           time.Duration `default:"30s" split_words:"true"`
+	AuthBreakerThreshold          int           `default:"5" split_words:"true"`
+	AuthCertBoundTokens           bool          `default:"false" split_words:"true"`
+	AuthHeader                    string        `split_words:"true"`
+	AuthPartnerTenantURLs         []string      `split_words:"true"`
+	AuthResource                  string        `split_words:"true"`
+	AuthScheme                    string        `split_words:"true"`
+	AuthScope                     string        `split_words:"true"`
+	AuthTenantURL                 string        `split_words:"true"`
+	AuthTokenCacheTTL             time.Duration `default:"0s" split_words:"true"`
+	CleanPathRedirect             bool          `default:"false" split_words:"true"`
+	DebugSlowRequests             int           `default:"20" split_words:"true"`
+	ForwardedProtoHeader          string        `split_words:"true"`
+	MaxInFlight                   int           `default:"0" split_words:"true"`
+	MaxInFlightQueueTimeout       time.Duration `default:"0s" split_words:"true"`
+	MetricsAddr                   string        `default:":5000" required:"true" split_words:"true"`
+	NewRelicApiKey                string        `split_words:"true"`
+	NewRelicAppName               string        `default:"go-api-local" required:"true" split_words:"true"`
+	PreShutdownDelay              time.Duration `default:"0s" split_words:"true"`
+	ProbeCacheTTL                 time.Duration `default:"10s" split_words:"true"`
+	ProbeTimeout                  time.Duration `default:"10s" split_words:"true"`
+	ProxyAllowHeaders             []string      `split_words:"true"`
+	ProxyAllowedMethods           []string      `split_words:"true"`
+	ProxyBufferBytes              int64         `default:"1048576" split_words:"true"`
+	ProxyCAFile                   string        `split_words:"true"`
+	ProxyCacheKeyHeaders          []string      `split_words:"true"`
+	ProxyCacheTTL                 time.Duration `default:"0s" split_words:"true"`
+	ProxyClientCertFile           string        `split_words:"true"`
+	ProxyClientKeyFile            string        `split_words:"true"`
+	ProxyDenyHeaders              []string      `default:"Authorization,Cookie" split_words:"true"`
+	ProxyDryRun                   bool          `default:"false" split_words:"true"`
+	ProxyETags                    bool          `default:"false" split_words:"true"`
+	ProxyGunzipRequests           bool          `default:"false" split_words:"true"`
+	ProxyIdleConnTimeout          time.Duration `default:"90s" split_words:"true"`
+	ProxyMaxBodyBytes             int64         `default:"10485760" split_words:"true"`
+	ProxyMaxIdleConnsPerHost      int           `default:"100" split_words:"true"`
+	ProxyMaxResponseBytes         int64         `default:"0" split_words:"true"`
+	ProxyRedirectHosts            []string      `split_words:"true"`
+	ProxyRequestIDHeaders         []string      `split_words:"true"`
+	ProxyRequireUTF8JSON          bool          `default:"false" split_words:"true"`
+	ProxyRequiredFields           []string      `split_words:"true"`
+	ProxyRequiredHeaders          []string      `split_words:"true"`
+	ProxyResponseHeaderTimeout    time.Duration `default:"30s" split_words:"true"`
+	ProxyRetries                  int           `default:"0" split_words:"true"`
+	ProxySignatureHeader          string        `default:"X-Signature" split_words:"true"`
+	ProxySignatureTimestampHeader string        `default:"X-Signature-Timestamp" split_words:"true"`
+	ProxySigningSecret            string        `split_words:"true"`
+	ProxyTimeout                  time.Duration `default:"30s" split_words:"true"`
+	ProxyUpstreams                []string      `split_words:"true"`
+	RateLimit                     float64       `default:"0" split_words:"true"`
+	RateLimitBurst                int           `default:"10" split_words:"true"`
+	ReadTimeout                   time.Duration `default:"30s" required:"true" split_words:"true"`
+	RejectUncleanPaths            bool          `default:"false" split_words:"true"`
+	RequestBudget                 time.Duration `default:"0s" split_words:"true"`
+	RequireHTTPS                  bool          `default:"false" split_words:"true"`
+	RequireJSONAccept             bool          `default:"false" split_words:"true"`
+	SignatureHeader               string        `default:"X-Signature" split_words:"true"`
+	SignatureTimestampHeader      string        `default:"X-Signature-Timestamp" split_words:"true"`
+	SignatureWindow               time.Duration `default:"5m" split_words:"true"`
+	SigningSecret                 string        `split_words:"true"`
+	TLSCertFile                   string        `split_words:"true"`
+	TLSClientCAFile               string        `split_words:"true"`
+	TLSKeyFile                    string        `split_words:"true"`
+	WriteKeys                     []string      `split_words:"true"`
+	WriteTimeout                  time.Duration `default:"30s" required:"true" split_words:"true"`
 }
 
 func main() {
+	start := time.Now()
+
 	l := log.NewJSONLogger(os.Stdout)
 	l = log.WithPrefix(l, "build", build)
 	l = log.WithPrefix(l, "date", log.DefaultTimestampUTC)
@@ -37,19 +104,77 @@ func main() {
 		panic(err)
 	}
 
-	// Create a new relic instance so that we have distributed tracing throughout the application
-	nrConfig := newrelic.NewConfig(c.NewRelicAppName, c.NewRelicApiKey)
-	nrConfig.CrossApplicationTracer.Enabled = false
-	nrConfig.DistributedTracer.Enabled = true
-	nrConfig.Labels = map[string]string{
-		"group": "make",
+	nr := newNewRelicApp(c.NewRelicAppName, c.NewRelicApiKey, l)
+
+	pm, err := api.NewProxyMetrics(prometheus.DefaultRegisterer)
+	if err != nil {
+		l.Log("level", "error", "msg", "could not register proxy metrics", "err", err.Error())
+		os.Exit(1)
+	}
+
+	am, err := api.NewAuthMetrics(prometheus.DefaultRegisterer)
+	if err != nil {
+		l.Log("level", "error", "msg", "could not register auth metrics", "err", err.Error())
+		os.Exit(1)
 	}
-	nr, err := newrelic.NewApplication(nrConfig)
+
+	im, err := api.NewInFlightMetrics(prometheus.DefaultRegisterer)
 	if err != nil {
-		l.Log("level", "error", "msg", "could not create new relic application", "err", err.Error())
+		l.Log("level", "error", "msg", "could not register in flight metrics", "err", err.Error())
+		os.Exit(1)
+	}
+
+	authClient, err := api.NewAuthClient(c.AuthBreakerThreshold, c.AuthBreakerCooldown, prometheus.DefaultRegisterer)
+	if err != nil {
+		l.Log("level", "error", "msg", "could not register auth circuit metrics", "err", err.Error())
+		os.Exit(1)
+	}
+
+	tenantURLs := c.AuthPartnerTenantURLs
+	if c.AuthTenantURL != "" {
+		tenantURLs = append([]string{c.AuthTenantURL}, tenantURLs...)
+	}
+	for _, tenantURL := range tenantURLs {
+		if err := api.ValidateTenantURL(tenantURL); err != nil {
+			l.Log("level", "error", "msg", "invalid auth tenant URL", "err", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if err := api.ValidateRateLimit(c.RateLimit, c.RateLimitBurst); err != nil {
+		l.Log("level", "error", "msg", "invalid rate limit", "err", err.Error())
 		os.Exit(1)
 	}
 
+	// Tokens can only be verified once we know who we are and who issues them.
+	// When partner tenants issue them too, each token is passed to the
+	// verifier for its issuer.
+	var verifier api.Verifier
+	if len(tenantURLs) > 0 && c.AuthResource != "" {
+		verifiers := make(map[string]api.Verifier, len(tenantURLs))
+		for _, tenantURL := range tenantURLs {
+			verifiers[tenantURL] = &rvAuth.Verifier{
+				Resource:   c.AuthResource,
+				TenantURL:  tenantURL,
+				HTTPClient: authClient,
+			}
+		}
+
+		verifier = verifiers[tenantURLs[0]]
+		if len(verifiers) > 1 {
+			verifier = api.NewMultiVerifier(verifiers)
+		}
+	}
+
+	// Tokens presented again soon after being verified can be remembered,
+	// rather than having their signature checked on every request
+	var tokenCache *api.TokenCache
+	if verifier != nil && c.AuthTokenCacheTTL > 0 {
+		tokenCache = api.NewTokenCache(verifier, c.AuthTokenCacheTTL)
+	}
+
+	slowRequests := api.NewSlowRequests(c.DebugSlowRequests)
+
 	// We make a buffered channel of 2 so that each go routine has a chance to exit when the server stops.
 	var errs = make(chan error, 2)
 
@@ -60,32 +185,181 @@ func main() {
 		WriteTimeout: time.Second * 30,
 	}
 	go func() {
-		http.Handle("/metrics", promhttp.Handler())
+		// OpenMetrics has to be enabled for the exemplars on the proxy latency
+		// to be served, to scrapers that ask for it
+		http.Handle("/metrics", promhttp.InstrumentMetricHandler(
+			prometheus.DefaultRegisterer,
+			promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}),
+		))
+		http.Handle("/info", api.InfoHandler(build, start))
+
+		// The admin handlers can only be reached on the metrics server, and only
+		// when an admin token has been configured.
+		if c.AdminToken != "" {
+			resetters := map[string]api.CacheResetter{}
+			if r, ok := verifier.(api.CacheResetter); ok {
+				resetters["verifier"] = r
+			}
+			if tokenCache != nil {
+				resetters["tokens"] = tokenCache
+			}
+			http.Handle("/admin/", api.AdminHandler(c.AdminToken, resetters))
+		}
+
+		// Let developers see what their token carries, without exposing it publicly
+		if verifier != nil {
+			http.Handle("/debug/claims", api.ClaimsHandler(verifier, c.AuthResource, l))
+		}
+
+		// The slowest requests can be looked into without an APM
+		http.Handle("/debug/slow-requests", api.SlowRequestsHandler(slowRequests))
+
 		l.Log("level", "info", "msg", "starting metrics server", "addr", c.MetricsAddr)
 		errs <- metricsServer.ListenAndServe()
 		l.Log("level", "info", "msg", "stopped metrics server")
 	}()
 
-	h := handler{
-		l:              l,
-		optionProxyURL: "https://slowgest-staging.make.rvapps.io/v1/webhooks/iterable",
+	proxyTLS, err := api.LoadProxyTLSConfig(c.ProxyCAFile, c.ProxyClientCertFile, c.ProxyClientKeyFile)
+	if err != nil {
+		l.Log("level", "error", "msg", "could not load proxy tls config", "err", err.Error())
+		os.Exit(1)
+	}
+
+	serverTLS, err := api.LoadServerTLSConfig(c.TLSCertFile, c.TLSKeyFile, c.TLSClientCAFile)
+	if err != nil {
+		l.Log("level", "error", "msg", "could not load server tls config", "err", err.Error())
+		os.Exit(1)
+	}
+	if err := api.ValidateCertBinding(c.AuthCertBoundTokens, serverTLS); err != nil {
+		l.Log("level", "error", "msg", "invalid certificate bound tokens", "err", err.Error())
+		os.Exit(1)
+	}
+
+	upstreams, err := api.ParseUpstreams(c.ProxyUpstreams)
+	if err != nil {
+		l.Log("level", "error", "msg", "invalid proxy upstreams", "err", err.Error())
+		os.Exit(1)
+	}
+
+	// Only report that we are ready once the things we depend on are reachable.
+	// Partner tenants are left out, so that one of them being down doesn't
+	// take every other caller down with it.
+	ready := api.NewReadiness()
+	if c.AuthTenantURL != "" {
+		ready.Register("jwks", 5*time.Second, api.CachedCheck(api.JWKSCheck(http.DefaultClient, c.AuthTenantURL), c.ProbeCacheTTL))
+	}
+
+	// Access logs are only written when a format has been configured
+	switch api.AccessLogFormat(c.AccessLogFormat) {
+	case "", api.AccessLogCommon, api.AccessLogCombined:
+	default:
+		l.Log("level", "error", "msg", "unknown access log format", "format", c.AccessLogFormat)
+		os.Exit(1)
+	}
+
+	deps := api.Deps{
+		Logger:          l,
+		NewRelic:        nr,
+		AuthMetrics:     am,
+		Ready:           ready,
+		ProxyClient:     api.NewProxyClient(c.ProxyMaxIdleConnsPerHost, c.ProxyIdleConnTimeout, c.ProxyResponseHeaderTimeout, c.ProxyRedirectHosts, proxyTLS),
+		ProxyMetrics:    pm,
+		InFlightMetrics: im,
+		SlowRequests:    slowRequests,
+		AccessLog:       os.Stdout,
+	}
+
+	// Only set the token cache when there is one, a nil pointer in the
+	// interface would not compare as nil
+	deps.Verifier = verifier
+	if tokenCache != nil {
+		deps.Verifier = tokenCache
 	}
 
+	appHandler := api.New(api.Config{
+		Version: build,
+
+		AccessLogFormat:     api.AccessLogFormat(c.AccessLogFormat),
+		AccessLogSampleRate: c.AccessLogSampleRate,
+
+		CleanPathRedirect:  c.CleanPathRedirect,
+		RejectUncleanPaths: c.RejectUncleanPaths,
+		RequireJSONAccept:  c.RequireJSONAccept,
+
+		RequireHTTPS:         c.RequireHTTPS,
+		ForwardedProtoHeader: c.ForwardedProtoHeader,
+
+		Scope:           c.AuthScope,
+		AuthHeader:      c.AuthHeader,
+		AuthScheme:      c.AuthScheme,
+		CertBoundTokens: c.AuthCertBoundTokens,
+
+		ProxyURL:              "https://slowgest-staging.make.rvapps.io/v1/webhooks/iterable",
+		ProxyUpstreams:        upstreams,
+		ProxyDryRun:           c.ProxyDryRun,
+		ProxyTimeout:          c.ProxyTimeout,
+		ProbeTimeout:          c.ProbeTimeout,
+		RequestBudget:         c.RequestBudget,
+		ProxyAllowedMethods:   c.ProxyAllowedMethods,
+		ProxyAllowHeaders:     c.ProxyAllowHeaders,
+		ProxyDenyHeaders:      c.ProxyDenyHeaders,
+		ProxyGunzipRequests:   c.ProxyGunzipRequests,
+		ProxyRequireUTF8JSON:  c.ProxyRequireUTF8JSON,
+		ProxyRequiredFields:   c.ProxyRequiredFields,
+		ProxyRequiredHeaders:  c.ProxyRequiredHeaders,
+		ProxyRequestIDHeaders: c.ProxyRequestIDHeaders,
+		ProxyRetries:          c.ProxyRetries,
+		ProxyBufferBytes:      c.ProxyBufferBytes,
+		ProxyMaxBodyBytes:     c.ProxyMaxBodyBytes,
+		ProxyCacheTTL:         c.ProxyCacheTTL,
+		ProxyCacheKeyHeaders:  c.ProxyCacheKeyHeaders,
+		ProxyETags:            c.ProxyETags,
+		ProxyMaxResponseBytes: c.ProxyMaxResponseBytes,
+
+		ProxySigningSecret:            c.ProxySigningSecret,
+		ProxySignatureHeader:          c.ProxySignatureHeader,
+		ProxySignatureTimestampHeader: c.ProxySignatureTimestampHeader,
+
+		MaxInFlight:             c.MaxInFlight,
+		MaxInFlightQueueTimeout: c.MaxInFlightQueueTimeout,
+
+		RateLimit:      c.RateLimit,
+		RateLimitBurst: c.RateLimitBurst,
+
+		WriteKeys: c.WriteKeys,
+
+		SigningSecret:            c.SigningSecret,
+		SignatureHeader:          c.SignatureHeader,
+		SignatureTimestampHeader: c.SignatureTimestampHeader,
+		SignatureWindow:          c.SignatureWindow,
+	}, deps)
+
 	appServer := http.Server{
 		Addr:         c.Addr,
-		Handler:      newRouter(h, nr),
+		Handler:      appHandler,
 		ReadTimeout:  c.ReadTimeout,
 		WriteTimeout: c.WriteTimeout,
+		TLSConfig:    serverTLS,
+	}
+	appListener, err := listen(c.Addr)
+	if err != nil {
+		l.Log("level", "error", "msg", "could not listen", "addr", c.Addr, "err", err.Error())
+		os.Exit(1)
 	}
 	go func() {
-		l.Log("level", "info", "msg", "starting application server", "addr", c.Addr)
+		l.Log("level", "info", "msg", "starting application server", "addr", c.Addr, "tls", serverTLS != nil)
 
-		errs <- appServer.ListenAndServe()
+		// The certificate is in the TLS config, rather than in a file
+		if serverTLS != nil {
+			errs <- appServer.ServeTLS(appListener, "", "")
+		} else {
+			errs <- appServer.Serve(appListener)
+		}
 
 		l.Log("level", "info", "msg", "stopped application server")
 	}()
 
-	osSignals := make(chan os.Signal)
+	osSignals := make(chan os.Signal, 1)
 	signal.Notify(osSignals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL)
 	select {
 	case err := <-errs:
@@ -94,6 +368,12 @@ func main() {
 	case s := <-osSignals:
 		l.Log("level", "info", "msg", "received signal", "signal", s)
 
+		// Fail the readiness probe first, and give load balancers time to
+		// notice before we stop accepting connections
+		ready.Drain()
+		l.Log("level", "info", "msg", "draining before shutdown", "delay", c.PreShutdownDelay.String())
+		time.Sleep(c.PreShutdownDelay)
+
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
 
 		l.Log("level", "info", "msg", "stopping metrics server")
@@ -116,9 +396,3 @@ func main() {
 		os.Exit(0)
 	}
 }
-
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("Content-Type", "application/json")
-	w.Write([]byte("Healthy AF"))
-	w.WriteHeader(http.StatusOK)
-}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/go-kit/kit/log"
+	newrelic "github.com/newrelic/go-agent"
+)
+
+// newNewRelicApp creates the New Relic application that gives us distributed
+// tracing throughout the application. New Relic isn't required to serve
+// requests, so when there is no license key or the application can't be
+// created a warning is logged and nil is returned, which the API treats as
+// running without New Relic.
+func newNewRelicApp(appName, licenseKey string, l log.Logger) newrelic.Application {
+	if licenseKey == "" {
+		l.Log("level", "warn", "msg", "no new relic license key, running without new relic")
+		return nil
+	}
+
+	nrConfig := newrelic.NewConfig(appName, licenseKey)
+	nrConfig.CrossApplicationTracer.Enabled = false
+	nrConfig.DistributedTracer.Enabled = true
+	nrConfig.Labels = map[string]string{
+		"group": "make",
+	}
+	nr, err := newrelic.NewApplication(nrConfig)
+	if err != nil {
+		l.Log("level", "warn", "msg", "could not create new relic application, running without new relic", "err", err.Error())
+		return nil
+	}
+	return nr
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/coulterac/go-api/internal/api"
+	"github.com/go-kit/kit/log"
+)
+
+func TestNewNewRelicApp(t *testing.T) {
+	type testCase struct {
+		name       string
+		licenseKey string
+	}
+
+	cases := []testCase{
+		testCase{
+			name: "no license key",
+		},
+		testCase{
+			name:       "invalid license key",
+			licenseKey: "unit-test",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			nr := newNewRelicApp("unit-test", c.licenseKey, log.NewLogfmtLogger(&buf))
+			if nr != nil {
+				t.Errorf("expected to run without new relic; got: %v", nr)
+			}
+
+			if !strings.Contains(buf.String(), "level=warn") {
+				t.Errorf("expected a warning to be logged; got: %q", buf.String())
+			}
+
+			h := api.New(api.Config{}, api.Deps{
+				Logger:   log.NewNopLogger(),
+				NewRelic: nr,
+			})
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, http.StatusOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// withRequireJSONAccept responds with a 406 when the request has an Accept
+// header that doesn't allow JSON, since JSON is all the API responds with,
+// apart from the event streams relayed on streamPaths. Requests to those can
+// accept text/event-stream instead. A request without an Accept header accepts
+// anything.
+func withRequireJSONAccept(next http.Handler, streamPaths ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept := strings.Join(r.Header.Values("Accept"), ",")
+		if strings.TrimSpace(accept) == "" || acceptsJSON(accept) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		for _, path := range streamPaths {
+			if r.URL.Path == path && acceptsEventStream(accept) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		sendError(w, r, http.StatusNotAcceptable, "responses are only available as application/json")
+	})
+}
+
+// acceptsJSON reports whether an Accept header has a media range matching
+// application/json with a non-zero quality.
+func acceptsJSON(accept string) bool {
+	return accepts(accept, "application/json", "application/*", "*/*")
+}
+
+// acceptsEventStream reports whether an Accept header has a media range
+// matching text/event-stream with a non-zero quality.
+func acceptsEventStream(accept string) bool {
+	return accepts(accept, "text/event-stream", "text/*")
+}
+
+// accepts reports whether an Accept header has a media range that is one of
+// mediaTypes with a non-zero quality.
+func accepts(accept string, mediaTypes ...string) bool {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil || !containsMediaType(mediaTypes, mediaType) {
+			continue
+		}
+
+		if q, ok := params["q"]; ok {
+			if v, err := strconv.ParseFloat(q, 64); err != nil || v <= 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func containsMediaType(mediaTypes []string, mediaType string) bool {
+	for _, t := range mediaTypes {
+		if t == mediaType {
+			return true
+		}
+	}
+	return false
+}
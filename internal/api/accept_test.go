@@ -0,0 +1,100 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithRequireJSONAccept(t *testing.T) {
+	type testCase struct {
+		name       string
+		path       string
+		accept     []string
+		statusCode int
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "missing",
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "json",
+			accept:     []string{"application/json"},
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "json with parameters",
+			accept:     []string{"text/html, application/json; charset=utf-8; q=0.5"},
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "anything",
+			accept:     []string{"*/*"},
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "any application type",
+			accept:     []string{"application/*"},
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "json in a second header",
+			accept:     []string{"text/html", "application/json"},
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "excludes json",
+			accept:     []string{"text/html, application/xml"},
+			statusCode: http.StatusNotAcceptable,
+		},
+		testCase{
+			name:       "json refused",
+			accept:     []string{"text/html, application/json;q=0"},
+			statusCode: http.StatusNotAcceptable,
+		},
+		testCase{
+			name:       "event stream",
+			accept:     []string{"text/event-stream"},
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "event stream refused",
+			accept:     []string{"text/event-stream;q=0"},
+			statusCode: http.StatusNotAcceptable,
+		},
+		testCase{
+			name:       "event stream elsewhere",
+			path:       "/health",
+			accept:     []string{"text/event-stream"},
+			statusCode: http.StatusNotAcceptable,
+		},
+		testCase{
+			name:       "malformed",
+			accept:     []string{"application/json;q"},
+			statusCode: http.StatusNotAcceptable,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := withRequireJSONAccept(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), "/v1/proxy")
+
+			path := c.path
+			if path == "" {
+				path = "/v1/proxy"
+			}
+			r := httptest.NewRequest(http.MethodGet, path, nil)
+			for _, v := range c.accept {
+				r.Header.Add("Accept", v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", w.Code, c.statusCode)
+			}
+		})
+	}
+}
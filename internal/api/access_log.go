@@ -0,0 +1,155 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AccessLogFormat is the line format used by withAccessLog.
+type AccessLogFormat string
+
+const (
+	// AccessLogCommon is the NCSA Common Log Format.
+	AccessLogCommon AccessLogFormat = "common"
+
+	// AccessLogCombined is the Apache Combined Log Format, which is the common
+	// format with the referer and user agent appended.
+	AccessLogCombined AccessLogFormat = "combined"
+)
+
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// accessLogResponseWriter records the status and number of bytes written so
+// that they can be logged after the request has been served.
+type accessLogResponseWriter struct {
+	w      http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *accessLogResponseWriter) Header() http.Header {
+	return w.w.Header()
+}
+
+func (w *accessLogResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.w.WriteHeader(status)
+}
+
+func (w *accessLogResponseWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.size += n
+	return n, err
+}
+
+func (w *accessLogResponseWriter) Flush() {
+	if f, ok := w.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// accessLogSampler reports whether a successful response should be logged.
+type accessLogSampler func() bool
+
+// sampleOneIn logs one in every n successful responses. Every one is logged
+// when n is 0 or 1, and none are when n is negative.
+func sampleOneIn(n int) accessLogSampler {
+	if n < 0 {
+		return func() bool { return false }
+	}
+	if n <= 1 {
+		return nil
+	}
+
+	var count uint64
+	return func() bool {
+		return (atomic.AddUint64(&count, 1)-1)%uint64(n) == 0
+	}
+}
+
+// withAccessLog writes a line in the given format to out for every request.
+// This is for tooling that ingests web server logs, and is separate from the
+// structured logs everything else writes. Responses under 400 are only logged
+// when sample says so, if it is set; errors are always logged.
+func withAccessLog(next http.Handler, out io.Writer, format AccessLogFormat, sample accessLogSampler) http.Handler {
+	var mutex sync.Mutex
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		lw := &accessLogResponseWriter{
+			w:      w,
+			status: http.StatusOK,
+		}
+		next.ServeHTTP(lw, r)
+
+		if lw.status < http.StatusBadRequest && sample != nil && !sample() {
+			return
+		}
+
+		line := formatAccessLog(r, lw.status, lw.size, start, format)
+
+		// Keep lines from concurrent requests from interleaving
+		mutex.Lock()
+		defer mutex.Unlock()
+		io.WriteString(out, line)
+	})
+}
+
+func formatAccessLog(r *http.Request, status, size int, start time.Time, format AccessLogFormat) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	// The user is a write key, which is a credential of its own
+	user, _, _ := r.BasicAuth()
+	user = redactWriteKey(user)
+
+	bytes := "-"
+	if size > 0 {
+		bytes = strconv.Itoa(size)
+	}
+
+	line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s",
+		host,
+		orDash(user),
+		start.Format(clfTimeFormat),
+		r.Method,
+		r.RequestURI,
+		r.Proto,
+		status,
+		bytes,
+	)
+
+	if format == AccessLogCombined {
+		line += fmt.Sprintf(" %q %q", orDash(r.Referer()), orDash(r.UserAgent()))
+	}
+
+	return line + "\n"
+}
+
+// redactWriteKey keeps just enough of a write key to tell clients apart in
+// the log. Short keys are left out entirely, as four characters would give
+// away too much of them.
+func redactWriteKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	if len(key) <= 8 {
+		return "…"
+	}
+	return key[:4] + "…"
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
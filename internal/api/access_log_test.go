@@ -0,0 +1,176 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestWithAccessLog(t *testing.T) {
+	type testCase struct {
+		name    string
+		format  AccessLogFormat
+		status  int
+		body    string
+		pattern string
+	}
+
+	// The date is the only part of the line that changes between runs
+	date := `\[\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\]`
+
+	cases := []testCase{
+		testCase{
+			name:    "common",
+			format:  AccessLogCommon,
+			status:  http.StatusCreated,
+			body:    "unit-test",
+			pattern: `^192\.0\.2\.1 - writ… ` + date + ` "POST /v1/proxy\?a=b HTTP/1\.1" 201 9\n$`,
+		},
+		testCase{
+			name:    "combined",
+			format:  AccessLogCombined,
+			status:  http.StatusCreated,
+			body:    "unit-test",
+			pattern: `^192\.0\.2\.1 - writ… ` + date + ` "POST /v1/proxy\?a=b HTTP/1\.1" 201 9 "https://example\.com/" "unit-test/1\.0"\n$`,
+		},
+		testCase{
+			name:    "empty body",
+			format:  AccessLogCommon,
+			status:  http.StatusNoContent,
+			pattern: `^192\.0\.2\.1 - writ… ` + date + ` "POST /v1/proxy\?a=b HTTP/1\.1" 204 -\n$`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var out bytes.Buffer
+			h := withAccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(c.status)
+				w.Write([]byte(c.body))
+			}), &out, c.format, nil)
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/proxy?a=b", nil)
+			r.SetBasicAuth("write-key", "")
+			r.Header.Set("Referer", "https://example.com/")
+			r.Header.Set("User-Agent", "unit-test/1.0")
+
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if !regexp.MustCompile(c.pattern).MatchString(out.String()) {
+				t.Errorf("expected log line to match %s; got: %q", c.pattern, out.String())
+			}
+		})
+	}
+}
+
+func TestWithAccessLogRedactsWriteKey(t *testing.T) {
+	type testCase struct {
+		name     string
+		writeKey string
+		user     string
+	}
+
+	cases := []testCase{
+		testCase{
+			name:     "write key",
+			writeKey: "wk_3f9a8c1d2e7b4a60",
+			user:     "wk_3…",
+		},
+		testCase{
+			name:     "short write key",
+			writeKey: "wk_3f9a",
+			user:     "…",
+		},
+		testCase{
+			name: "no write key",
+			user: "-",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var out bytes.Buffer
+			h := withAccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), &out, AccessLogCombined, nil)
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/proxy", nil)
+			if c.writeKey != "" {
+				r.SetBasicAuth(c.writeKey, "")
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if c.writeKey != "" && strings.Contains(out.String(), c.writeKey) {
+				t.Errorf("expected the write key to be left out of the log line; got: %q", out.String())
+			}
+			if fields := strings.Fields(out.String()); len(fields) < 3 || fields[2] != c.user {
+				t.Errorf("expected users to match; got: %q, want %q", out.String(), c.user)
+			}
+		})
+	}
+}
+
+func TestWithAccessLogSampling(t *testing.T) {
+	type testCase struct {
+		name   string
+		rate   int
+		status int
+		want   int
+	}
+
+	cases := []testCase{
+		testCase{
+			name:   "every success by default",
+			status: http.StatusOK,
+			want:   10,
+		},
+		testCase{
+			name:   "one in five successes",
+			rate:   5,
+			status: http.StatusOK,
+			want:   2,
+		},
+		testCase{
+			name:   "one in five redirects",
+			rate:   5,
+			status: http.StatusFound,
+			want:   2,
+		},
+		testCase{
+			name:   "no successes",
+			rate:   -1,
+			status: http.StatusOK,
+			want:   0,
+		},
+		testCase{
+			name:   "every client error",
+			rate:   5,
+			status: http.StatusNotFound,
+			want:   10,
+		},
+		testCase{
+			name:   "every server error",
+			rate:   -1,
+			status: http.StatusBadGateway,
+			want:   10,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var out bytes.Buffer
+			h := withAccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(c.status)
+			}), &out, AccessLogCommon, sampleOneIn(c.rate))
+
+			for i := 0; i < 10; i++ {
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/proxy", nil))
+			}
+
+			if got := strings.Count(out.String(), "\n"); got != c.want {
+				t.Errorf("expected number of lines logged to match; got: %v, want %v", got, c.want)
+			}
+		})
+	}
+}
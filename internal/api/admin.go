@@ -0,0 +1,66 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// CacheResetter is anything with a cache that can be flushed on demand, such
+// as *rvAuth.Granter and *rvAuth.Verifier.
+type CacheResetter interface {
+	ResetCache()
+}
+
+// AdminHandler serves the admin endpoints, which all require token. It must
+// only be served on the internal metrics server.
+func AdminHandler(token string, resetters map[string]CacheResetter) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/admin/reset-caches", withAdminToken(resetCachesHandler(resetters), token))
+	return mux
+}
+
+type resetCachesResponse struct {
+	Reset []string `json:"reset"`
+}
+
+// resetCachesHandler flushes every cache in resetters. This is for incident
+// response, such as after an emergency credential rotation, and must only be
+// registered on the internal server behind withAdminToken.
+func resetCachesHandler(resetters map[string]CacheResetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			sendError(w, r, http.StatusMethodNotAllowed, "caches can only be reset with a POST")
+			return
+		}
+
+		resp := resetCachesResponse{
+			Reset: make([]string, 0, len(resetters)),
+		}
+		for name, c := range resetters {
+			c.ResetCache()
+			resp.Reset = append(resp.Reset, name)
+		}
+		sort.Strings(resp.Reset)
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// withAdminToken requires requests to present token as a bearer token.
+func withAdminToken(next http.Handler, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented, ok := parseAuthToken(r.Header.Get("Authorization"), "Bearer")
+		if token == "" || !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			sendError(w, r, http.StatusUnauthorized, "a valid admin token is required")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
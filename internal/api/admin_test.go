@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+type fakeCache struct {
+	resets int
+}
+
+func (c *fakeCache) ResetCache() {
+	c.resets++
+}
+
+func TestResetCachesHandler(t *testing.T) {
+	type testCase struct {
+		name          string
+		method        string
+		authorization string
+		statusCode    int
+		resets        int
+	}
+
+	cases := []testCase{
+		testCase{
+			name:          "reset",
+			method:        http.MethodPost,
+			authorization: "Bearer admin-token",
+			statusCode:    http.StatusOK,
+			resets:        1,
+		},
+		testCase{
+			name:          "wrong token",
+			method:        http.MethodPost,
+			authorization: "Bearer unit-test",
+			statusCode:    http.StatusUnauthorized,
+		},
+		testCase{
+			name:          "bare token",
+			method:        http.MethodPost,
+			authorization: "admin-token",
+			statusCode:    http.StatusUnauthorized,
+		},
+		testCase{
+			name:       "missing token",
+			method:     http.MethodPost,
+			statusCode: http.StatusUnauthorized,
+		},
+		testCase{
+			name:          "not a POST",
+			method:        http.MethodGet,
+			authorization: "Bearer admin-token",
+			statusCode:    http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			granter := &fakeCache{}
+			verifier := &fakeCache{}
+			h := withAdminToken(resetCachesHandler(map[string]CacheResetter{
+				"granter":  granter,
+				"verifier": verifier,
+			}), "admin-token")
+
+			r := httptest.NewRequest(c.method, "/admin/reset-caches", nil)
+			if c.authorization != "" {
+				r.Header.Set("Authorization", c.authorization)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.statusCode)
+			}
+			if granter.resets != c.resets || verifier.resets != c.resets {
+				t.Errorf("expected resets to match; got: %v and %v, want: %v", granter.resets, verifier.resets, c.resets)
+			}
+			if c.statusCode != http.StatusOK {
+				return
+			}
+
+			var resp resetCachesResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err.Error())
+			}
+			if want := []string{"granter", "verifier"}; !reflect.DeepEqual(resp.Reset, want) {
+				t.Errorf("expected responses to match; got: %v, want: %v", resp.Reset, want)
+			}
+		})
+	}
+}
+
+func TestResetCachesNotPublic(t *testing.T) {
+	h := handler{
+		l: log.NewNopLogger(),
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer admin-token")
+	wr, _ := do(h, http.MethodPost, "/admin/reset-caches", header, nil)
+
+	if wr.Code != http.StatusNotFound {
+		t.Errorf("expected the admin handler to be unreachable on the public router; got: %v, want: %v", wr.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// withAllowedMethods responds with a 405 to requests that don't use one of
+// methods, listing them in the Allow header, so that they never reach the
+// upstream.
+func withAllowedMethods(next http.Handler, methods ...string) http.Handler {
+	allowed := make(map[string]bool, len(methods))
+	names := make([]string, 0, len(methods))
+	for _, m := range methods {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		allowed[m] = true
+		names = append(names, m)
+	}
+	allow := strings.Join(names, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowed[r.Method] {
+			w.Header().Set("Allow", allow)
+			sendError(w, r, http.StatusMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithAllowedMethods(t *testing.T) {
+	type testCase struct {
+		name       string
+		method     string
+		statusCode int
+		allow      string
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "POST",
+			method:     http.MethodPost,
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "PUT",
+			method:     http.MethodPut,
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "TRACE",
+			method:     http.MethodTrace,
+			statusCode: http.StatusMethodNotAllowed,
+			allow:      "POST, PUT",
+		},
+		testCase{
+			name:       "DELETE",
+			method:     http.MethodDelete,
+			statusCode: http.StatusMethodNotAllowed,
+			allow:      "POST, PUT",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			forwarded := false
+			h := withAllowedMethods(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				forwarded = true
+			}), "post", "PUT")
+
+			r := httptest.NewRequest(c.method, "/v1/proxy", nil)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.statusCode)
+			}
+			if forwarded != (c.statusCode == http.StatusOK) {
+				t.Errorf("expected the request to be forwarded only when allowed; got: %v", forwarded)
+			}
+			if got := rr.Header().Get("Allow"); got != c.allow {
+				t.Errorf("expected Allow headers to match; got: %q, want: %q", got, c.allow)
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+// Package api is the HTTP API served by cmd/server: the proxy, its probes and
+// every middleware in front of them. It is kept out of package main so that
+// the whole app can be built and tested without starting a server.
+package api
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	newrelic "github.com/newrelic/go-agent"
+)
+
+// Config holds the options for the API. The zero value of every option turns
+// the feature off, or uses its default.
+type Config struct {
+	// Version is the deployed build, sent back in the X-App-Version header
+	// and logged with every proxy request when it is set.
+	Version string
+
+	// AccessLogFormat is the format of the access log written to
+	// Deps.AccessLog. It must be empty, AccessLogCommon or AccessLogCombined.
+	AccessLogFormat AccessLogFormat
+
+	// AccessLogSampleRate logs one in every AccessLogSampleRate responses
+	// under 400 to the access log. Errors are always logged. Every response is
+	// logged when it is 0 or 1, and only errors are when it is negative.
+	AccessLogSampleRate int
+
+	// CleanPathRedirect redirects GET requests for unclean paths to the
+	// canonical path instead of rewriting them.
+	CleanPathRedirect bool
+
+	// RejectUncleanPaths rejects requests with duplicate slashes, . or ..
+	// segments or encoded slashes in their path, instead of cleaning them,
+	// so that they can never be used to reach an unintended upstream path.
+	// Trailing slashes are still cleaned.
+	RejectUncleanPaths bool
+
+	// RequireHTTPS rejects requests to the protected routes that weren't made
+	// over https. When TLS is terminated in front of the API,
+	// ForwardedProtoHeader is the trusted header carrying the client's scheme,
+	// such as X-Forwarded-Proto. The probes are always allowed.
+	RequireHTTPS         bool
+	ForwardedProtoHeader string
+
+	// RequireJSONAccept rejects requests with an Accept header that doesn't
+	// allow application/json.
+	RequireJSONAccept bool
+
+	// Scope is required of the bearer tokens for the protected routes when
+	// Deps.Verifier is set.
+	Scope string
+
+	// AuthHeader and AuthScheme are where the bearer token is read from, for
+	// edges such as gRPC-Web that can't send it as "Authorization: Bearer".
+	// The token is the whole of AuthHeader when it is set without AuthScheme.
+	// They default to Authorization and Bearer. A custom AuthHeader is never
+	// forwarded to the upstream unless it is in ProxyAllowHeaders.
+	AuthHeader string
+	AuthScheme string
+
+	// CertBoundTokens rejects tokens bound to a client certificate by their
+	// cnf claim unless they are presented over TLS with that certificate. The
+	// server has to be served with a LoadServerTLSConfig config for clients to
+	// have a certificate to present.
+	CertBoundTokens bool
+
+	// ProxyURL is the upstream every proxy request is sent to.
+	ProxyURL string
+
+	// ProxyUpstreams are replicas of the upstream at ProxyURL. Proxy requests
+	// are spread across them by weight, to ProxyURL's path on each, skipping
+	// any that keep failing.
+	ProxyUpstreams []Upstream
+
+	// ProxyTimeout and ProbeTimeout are how long the proxy route and the
+	// probes have to serve a request, on top of the server's own timeouts.
+	// Event streams from the proxy aren't held to ProxyTimeout.
+	ProxyTimeout time.Duration
+	ProbeTimeout time.Duration
+
+	// RequestBudget is the time every request is given to be served in. It
+	// isn't enforced, but handlers can check what is left of it with Budget,
+	// and the proxy doesn't retry when too little is.
+	RequestBudget time.Duration
+
+	// ProxyDryRun logs the requests that would be sent to the upstream and
+	// responds with a 200 instead of sending them, for checking a new
+	// integration's routing and headers.
+	ProxyDryRun bool
+
+	// ProxyAllowedMethods limits the methods proxy requests can use when it
+	// is set, such as POST for a webhook relay. Any other method is a 405.
+	ProxyAllowedMethods []string
+
+	// ProxyAllowHeaders limits the incoming headers forwarded to the upstream
+	// when it is set. ProxyDenyHeaders are never forwarded unless they are
+	// allowed.
+	ProxyAllowHeaders []string
+	ProxyDenyHeaders  []string
+
+	// ProxyRequiredFields are the fields a JSON body must have before it is
+	// forwarded to the upstream.
+	ProxyRequiredFields []string
+
+	// ProxyGunzipRequests decompresses gzip encoded request bodies before
+	// they are forwarded, for upstreams that can't. Signatures are checked
+	// against the body as it was sent.
+	ProxyGunzipRequests bool
+
+	// ProxyMaxBodyBytes is the largest request body the proxy reads itself,
+	// to validate or check the signature of it, decompress it or buffer it
+	// for retries and signing. Bigger bodies are rejected with a 413. Zero
+	// means no limit.
+	ProxyMaxBodyBytes int64
+
+	// ProxyRequireUTF8JSON strips a leading byte order mark from JSON request
+	// bodies and rejects the ones that aren't valid UTF-8.
+	ProxyRequireUTF8JSON bool
+
+	// ProxyRequiredHeaders are the headers that must be set on every proxy
+	// request.
+	ProxyRequiredHeaders []string
+
+	// ProxyRequestIDHeaders are the headers the trace ID is sent to the
+	// upstream in, for upstreams that correlate requests by their own header.
+	ProxyRequestIDHeaders []string
+
+	// ProxyRetries is the number of times a failed proxy request is retried,
+	// buffering up to ProxyBufferBytes of the body in memory.
+	ProxyRetries     int
+	ProxyBufferBytes int64
+
+	// ProxySigningSecret signs the bodies sent to the upstream, with the
+	// signature and timestamp sent in ProxySignatureHeader and
+	// ProxySignatureTimestampHeader.
+	ProxySigningSecret            string
+	ProxySignatureHeader          string
+	ProxySignatureTimestampHeader string
+
+	// ProxyMaxResponseBytes caps the size of the responses passed back from
+	// the upstream. Responses declaring a bigger Content-Length are a 502, and
+	// streamed ones are cut off at the cap.
+	ProxyMaxResponseBytes int64
+
+	// ProxyCacheTTL is how long successful GET responses are cached for.
+	// They are cached separately for every caller and every value of
+	// ProxyRequiredHeaders and ProxyCacheKeyHeaders.
+	ProxyCacheTTL        time.Duration
+	ProxyCacheKeyHeaders []string
+
+	// ProxyETags tags successful GET responses with an ETag and answers
+	// requests whose If-None-Match matches it with a 304, for clients that
+	// poll the upstream.
+	ProxyETags bool
+
+	// MaxInFlight caps the number of concurrent proxy requests, waiting up to
+	// MaxInFlightQueueTimeout for a slot.
+	MaxInFlight             int
+	MaxInFlightQueueTimeout time.Duration
+
+	// RateLimit is the number of requests per second each client can make to
+	// the proxy, with bursts of up to RateLimitBurst. Clients are told apart
+	// by their token subject, then their write key, then their address. See
+	// ValidateRateLimit.
+	RateLimit      float64
+	RateLimitBurst int
+
+	// WriteKeys are the basic auth write keys allowed to use the proxy.
+	WriteKeys []string
+
+	// SigningSecret requires incoming proxy requests to be signed, reading
+	// the signature and timestamp from SignatureHeader and
+	// SignatureTimestampHeader. The timestamp has to be within
+	// SignatureWindow when it is set.
+	SigningSecret            string
+	SignatureHeader          string
+	SignatureTimestampHeader string
+	SignatureWindow          time.Duration
+}
+
+// Deps are the things the API needs that are created by the caller. Every
+// one is optional.
+type Deps struct {
+	Logger log.Logger
+
+	// NewRelic traces every request. Nothing is traced when it is nil.
+	NewRelic newrelic.Application
+
+	// Verifier verifies the bearer tokens for the protected routes, which are
+	// open when it is nil.
+	Verifier Verifier
+
+	// AuthMetrics counts the decisions made by Verifier when it is set.
+	AuthMetrics *AuthMetrics
+
+	// Ready holds the checks for the readiness probe, which isn't served when
+	// it is nil.
+	Ready *Readiness
+
+	// ProxyClient makes the requests to the upstream, defaulting to a shared
+	// client with sensible timeouts.
+	ProxyClient *http.Client
+
+	// ProxyMetrics tracks the requests made to the upstream when it is set.
+	ProxyMetrics *ProxyMetrics
+
+	// InFlightMetrics tracks the proxy requests being served under
+	// Config.MaxInFlight when it is set.
+	InFlightMetrics *InFlightMetrics
+
+	// RequestTransform and ResponseTransform reshape the request to and the
+	// response from the upstream when they are set. An error from either is
+	// a 500.
+	RequestTransform  RequestTransform
+	ResponseTransform ResponseTransform
+
+	// SlowRequests keeps the slowest requests served when it is set.
+	SlowRequests *SlowRequests
+
+	// AccessLog is where the access log is written when
+	// Config.AccessLogFormat is set.
+	AccessLog io.Writer
+}
+
+// New creates the handler for the whole API.
+func New(cfg Config, deps Deps) http.Handler {
+	h := handler{
+		l:                 deps.Logger,
+		optionVersion:     cfg.Version,
+		ready:             deps.Ready,
+		slowRequests:      deps.SlowRequests,
+		optionProxyURL:    cfg.ProxyURL,
+		optionProxyDryRun: cfg.ProxyDryRun,
+
+		optionProxyTimeout:  cfg.ProxyTimeout,
+		optionProbeTimeout:  cfg.ProbeTimeout,
+		optionRequestBudget: cfg.RequestBudget,
+		proxyClient:         deps.ProxyClient,
+		proxyMetrics:        deps.ProxyMetrics,
+		inFlightMetrics:     deps.InFlightMetrics,
+
+		verifier:              deps.Verifier,
+		authMetrics:           deps.AuthMetrics,
+		optionScope:           cfg.Scope,
+		optionAuthHeader:      cfg.AuthHeader,
+		optionAuthScheme:      cfg.AuthScheme,
+		optionCertBoundTokens: cfg.CertBoundTokens,
+
+		requestTransform:  deps.RequestTransform,
+		responseTransform: deps.ResponseTransform,
+
+		optionCleanPathRedirect:  cfg.CleanPathRedirect,
+		optionRejectUncleanPaths: cfg.RejectUncleanPaths,
+		optionRequireJSONAccept:  cfg.RequireJSONAccept,
+
+		optionRequireHTTPS:         cfg.RequireHTTPS,
+		optionForwardedProtoHeader: cfg.ForwardedProtoHeader,
+
+		optionProxyAllowedMethods:   cfg.ProxyAllowedMethods,
+		optionProxyAllowHeaders:     cfg.ProxyAllowHeaders,
+		optionProxyDenyHeaders:      cfg.ProxyDenyHeaders,
+		optionProxyGunzipRequests:   cfg.ProxyGunzipRequests,
+		optionProxyMaxBodyBytes:     cfg.ProxyMaxBodyBytes,
+		optionProxyRequireUTF8JSON:  cfg.ProxyRequireUTF8JSON,
+		optionProxyRequiredFields:   cfg.ProxyRequiredFields,
+		optionProxyRequiredHeaders:  cfg.ProxyRequiredHeaders,
+		optionProxyRequestIDHeaders: cfg.ProxyRequestIDHeaders,
+		optionProxyRetries:          cfg.ProxyRetries,
+		optionProxyBufferBytes:      cfg.ProxyBufferBytes,
+		optionProxyMaxResponseBytes: cfg.ProxyMaxResponseBytes,
+		optionProxyCacheTTL:         cfg.ProxyCacheTTL,
+		optionProxyCacheKeyHeaders:  cfg.ProxyCacheKeyHeaders,
+		optionProxyETags:            cfg.ProxyETags,
+
+		optionProxySigningSecret:            cfg.ProxySigningSecret,
+		optionProxySignatureHeader:          cfg.ProxySignatureHeader,
+		optionProxySignatureTimestampHeader: cfg.ProxySignatureTimestampHeader,
+
+		optionMaxInFlight:             cfg.MaxInFlight,
+		optionMaxInFlightQueueTimeout: cfg.MaxInFlightQueueTimeout,
+
+		optionRateLimit:      cfg.RateLimit,
+		optionRateLimitBurst: cfg.RateLimitBurst,
+
+		optionWriteKeys: cfg.WriteKeys,
+
+		optionSigningSecret:            cfg.SigningSecret,
+		optionSignatureHeader:          cfg.SignatureHeader,
+		optionSignatureTimestampHeader: cfg.SignatureTimestampHeader,
+		optionSignatureWindow:          cfg.SignatureWindow,
+	}
+	if len(cfg.ProxyUpstreams) > 0 {
+		h.upstreams = newUpstreamPool(cfg.ProxyUpstreams)
+	}
+	if h.l == nil {
+		h.l = log.NewNopLogger()
+	}
+
+	nr := deps.NewRelic
+	if nr == nil {
+		nr = disabledNewRelicApp()
+	}
+
+	appHandler := newRouter(h, nr)
+	if cfg.AccessLogFormat != "" && deps.AccessLog != nil {
+		appHandler = withAccessLog(appHandler, deps.AccessLog, cfg.AccessLogFormat, sampleOneIn(cfg.AccessLogSampleRate))
+	}
+	return appHandler
+}
+
+// disabledNewRelicApp returns an application that never connects to New Relic
+// and records nothing.
+func disabledNewRelicApp() newrelic.Application {
+	nrConfig := newrelic.NewConfig("", "")
+	nrConfig.Enabled = false
+
+	// A disabled config without a license key always validates
+	nr, _ := newrelic.NewApplication(nrConfig)
+	return nr
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestNew(t *testing.T) {
+	type testCase struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		statusCode int
+		upstream   bool
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "health",
+			method:     http.MethodGet,
+			url:        "/health",
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "proxy",
+			method:     http.MethodPost,
+			url:        "/v1/proxy",
+			body:       `{"event":"unit-test"}`,
+			statusCode: http.StatusOK,
+			upstream:   true,
+		},
+		testCase{
+			name:       "proxy validation",
+			method:     http.MethodPost,
+			url:        "/v1/proxy",
+			body:       `{}`,
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var received string
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := ioutil.ReadAll(r.Body)
+				received = string(b)
+			}))
+			defer upstream.Close()
+
+			var accessLog bytes.Buffer
+			h := New(Config{
+				AccessLogFormat:     AccessLogCommon,
+				ProxyURL:            upstream.URL,
+				ProxyRequiredFields: []string{"event"},
+			}, Deps{
+				Logger:    log.NewNopLogger(),
+				AccessLog: &accessLog,
+			})
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(c.method, c.url, strings.NewReader(c.body)))
+
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.statusCode)
+			}
+			if c.upstream && received != c.body {
+				t.Errorf("expected the body to reach the upstream; got: %q, want: %q", received, c.body)
+			}
+			if !c.upstream && received != "" {
+				t.Errorf("expected the upstream not to be called; got: %q", received)
+			}
+			if !strings.Contains(accessLog.String(), c.url) {
+				t.Errorf("expected the request to be access logged; got: %q", accessLog.String())
+			}
+		})
+	}
+}
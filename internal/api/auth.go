@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	rvAuth "github.com/RedVentures/sdk-go/auth"
+	"github.com/go-kit/kit/log"
+)
+
+const contextKeyToken contextKey = "token"
+
+// Verifier verifies the bearer tokens presented with incoming requests. It is
+// satisfied by *rvAuth.Verifier.
+type Verifier interface {
+	VerifyToken(string) (*rvAuth.Token, error)
+}
+
+// tokenFromContext returns the token verified by withJWT.
+func tokenFromContext(ctx context.Context) (*rvAuth.Token, bool) {
+	token, ok := ctx.Value(contextKeyToken).(*rvAuth.Token)
+	return token, ok && token != nil
+}
+
+// claimsFromContext returns the claims of the token verified by withJWT.
+func claimsFromContext(ctx context.Context) (*rvAuth.Claims, bool) {
+	token, ok := tokenFromContext(ctx)
+	if !ok || token.Claims == nil {
+		return nil, false
+	}
+	return token.Claims, true
+}
+
+// tokenLogFields returns the sub, org_id and azp claims of the token verified
+// by withJWT as log key values, so that a request's logs say who made it. The
+// claims the token doesn't have are left out, and it is empty when there is no
+// token. The token itself is never included.
+func tokenLogFields(ctx context.Context) []interface{} {
+	token, ok := tokenFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	var fields []interface{}
+	if token.Claims != nil && token.Claims.Subject != "" {
+		fields = append(fields, "sub", token.Claims.Subject)
+	}
+
+	raw, _ := token.RawClaims()
+	for _, name := range []string{"org_id", "azp"} {
+		if v, ok := raw[name].(string); ok && v != "" {
+			fields = append(fields, name, v)
+		}
+	}
+	return fields
+}
+
+// withJWT requires every request to have a bearer token that v can verify,
+// responding with a 401 otherwise. It must run after withBearerToken, which
+// parses the token from the configured auth header. The verified token is
+// stored in the request context so that handlers can get at its claims with
+// claimsFromContext. Tokens that fail verification are logged to l with their
+// unverified subject, and every failure is counted in m.
+func withJWT(next http.Handler, v Verifier, l log.Logger, m *AuthMetrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, ok := bearerTokenFromContext(r.Context())
+		if !ok {
+			m.observe(authOutcomeMissingToken)
+			setAuthChallenge(w, r, "")
+			sendError(w, r, http.StatusUnauthorized, "a bearer token is required")
+			return
+		}
+
+		token, err := v.VerifyToken(raw)
+		if err != nil {
+			m.observe(authOutcomeInvalidToken)
+			l.Log("level", "warn", "msg", "invalid bearer token", "sub", unverifiedSubject(raw), "err", err.Error())
+			setAuthChallenge(w, r, `error="invalid_token"`)
+			sendError(w, r, http.StatusUnauthorized, "invalid bearer token")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), contextKeyToken, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// withScope requires the token verified by withJWT to have been granted scope,
+// responding with a 403 otherwise. It must run after withJWT. Denied requests
+// are logged to l with the token's subject and the scopes it does have, and
+// counted in m.
+func withScope(next http.Handler, scope string, l log.Logger, m *AuthMetrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := claimsFromContext(r.Context())
+		if !ok {
+			m.observe(authOutcomeMissingToken)
+			sendError(w, r, http.StatusUnauthorized, "a bearer token is required")
+			return
+		}
+
+		for _, s := range strings.Fields(claims.Scope) {
+			if s == scope {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		m.observe(authOutcomeInsufficientScope)
+		l.Log("level", "warn", "msg", "token is missing the required scope", "sub", claims.Subject, "scope", scope, "scopes", claims.Scope)
+		sendError(w, r, http.StatusForbidden, "token is missing the "+scope+" scope")
+	})
+}
+
+// unverifiedSubject returns the sub claim of raw without verifying it, so that
+// it is only fit for logging. It is empty when raw isn't a JWT.
+func unverifiedSubject(raw string) string {
+	return unverifiedClaims(raw).Subject
+}
+
+type registeredClaims struct {
+	Subject string `json:"sub"`
+	Issuer  string `json:"iss"`
+}
+
+// unverifiedClaims decodes the sub and iss claims of raw without verifying its
+// signature. They are empty when raw isn't a JWT.
+func unverifiedClaims(raw string) registeredClaims {
+	var claims registeredClaims
+	decodeClaims(raw, &claims)
+	return claims
+}
+
+// decodeClaims decodes the payload of the JWT raw into claims, without
+// verifying its signature.
+func decodeClaims(raw string, claims interface{}) error {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return errors.New("token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(payload, claims)
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestAuthMetrics(t *testing.T) {
+	type testCase struct {
+		name    string
+		token   string
+		outcome string
+	}
+
+	cases := []testCase{
+		testCase{
+			name:    "allow",
+			token:   "valid-token",
+			outcome: authOutcomeAllow,
+		},
+		testCase{
+			name:    "missing token",
+			outcome: authOutcomeMissingToken,
+		},
+		testCase{
+			name:    "invalid token",
+			token:   "invalid-token",
+			outcome: authOutcomeInvalidToken,
+		},
+		testCase{
+			name:    "insufficient scope",
+			token:   "unscoped-token",
+			outcome: authOutcomeInsufficientScope,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			m, err := NewAuthMetrics(reg)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			h := handler{
+				l:           log.NewNopLogger(),
+				optionScope: "write:proxy",
+				authMetrics: m,
+				verifier: fakeVerifier{
+					"unscoped-token": newTestToken("unscoped-token", "unit-test", "read:proxy"),
+					"valid-token":    newTestToken("valid-token", "unit-test", "write:proxy"),
+				},
+			}
+
+			header := http.Header{}
+			if c.token != "" {
+				header.Set("Authorization", "Bearer "+c.token)
+			}
+			do(h, http.MethodGet, "/v1/proxy", header, nil)
+
+			for _, outcome := range []string{authOutcomeAllow, authOutcomeMissingToken, authOutcomeInvalidToken, authOutcomeInsufficientScope} {
+				want := 0.0
+				if outcome == c.outcome {
+					want = 1
+				}
+				if got := metricValue(t, reg, "auth_decisions_total", map[string]string{"outcome": outcome}); got != want {
+					t.Errorf("expected %s decisions to match; got: %v, want: %v", outcome, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewAuthMetricsRegisteredTwice(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	for i := 0; i < 2; i++ {
+		if _, err := NewAuthMetrics(reg); err != nil {
+			t.Errorf("expected the metrics to be reused; got: %v", err)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	rvAuth "github.com/RedVentures/sdk-go/auth"
+	"github.com/go-kit/kit/log"
+)
+
+// fakeVerifier accepts the tokens it has been given, and nothing else.
+type fakeVerifier map[string]*rvAuth.Token
+
+func (v fakeVerifier) VerifyToken(token string) (*rvAuth.Token, error) {
+	t, ok := v[token]
+	if !ok {
+		return nil, errors.New("unit-test: invalid token")
+	}
+	return t, nil
+}
+
+func newTestToken(raw, sub, scope string) *rvAuth.Token {
+	claims := &rvAuth.Claims{
+		Scope: scope,
+	}
+	claims.Subject = sub
+
+	return &rvAuth.Token{
+		Raw:    raw,
+		Claims: claims,
+	}
+}
+
+func TestWithJWT(t *testing.T) {
+	type testCase struct {
+		name          string
+		authorization string
+		statusCode    int
+		subject       string
+	}
+
+	cases := []testCase{
+		testCase{
+			name:          "valid token",
+			authorization: "Bearer valid-token",
+			statusCode:    http.StatusOK,
+			subject:       "unit-test",
+		},
+		testCase{
+			name:          "invalid token",
+			authorization: "Bearer invalid-token",
+			statusCode:    http.StatusUnauthorized,
+		},
+		testCase{
+			name:       "missing token",
+			statusCode: http.StatusUnauthorized,
+		},
+		testCase{
+			name:          "not a bearer token",
+			authorization: "Basic dW5pdC10ZXN0Og==",
+			statusCode:    http.StatusUnauthorized,
+		},
+		testCase{
+			name:          "lowercase scheme",
+			authorization: "bearer valid-token",
+			statusCode:    http.StatusOK,
+			subject:       "unit-test",
+		},
+	}
+
+	v := fakeVerifier{
+		"valid-token": newTestToken("valid-token", "unit-test", "read:proxy"),
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var (
+				token     *rvAuth.Token
+				claims    *rvAuth.Claims
+				hasToken  bool
+				hasClaims bool
+			)
+			h := withJWT(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				token, hasToken = tokenFromContext(r.Context())
+				claims, hasClaims = claimsFromContext(r.Context())
+			}), v, log.NewNopLogger(), nil)
+			h = withBearerToken(h, "", "", nil)
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/proxy", nil)
+			if c.authorization != "" {
+				r.Header.Set("Authorization", c.authorization)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.statusCode)
+			}
+			if c.statusCode != http.StatusOK {
+				if rr.Header().Get("WWW-Authenticate") == "" {
+					t.Error("expected a bearer challenge")
+				}
+				return
+			}
+
+			if !hasToken || token.Raw != "valid-token" {
+				t.Errorf("expected the token in context; got: %v", token)
+			}
+			if !hasClaims || claims.Subject != c.subject {
+				t.Errorf("expected the claims in context; got: %v", claims)
+			}
+		})
+	}
+}
+
+func TestWithJWTChallenge(t *testing.T) {
+	type testCase struct {
+		name          string
+		authorization string
+		challenge     string
+	}
+
+	cases := []testCase{
+		testCase{
+			name:      "missing token",
+			challenge: "Grpc-Token",
+		},
+		testCase{
+			name:          "invalid token",
+			authorization: "Grpc-Token invalid-token",
+			challenge:     `Grpc-Token error="invalid_token"`,
+		},
+		testCase{
+			name:          "malformed token",
+			authorization: "Bearer valid-token",
+			challenge:     `Grpc-Token error="invalid_request"`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := withJWT(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), fakeVerifier{}, log.NewNopLogger(), nil)
+			h = withBearerToken(h, "", "Grpc-Token", nil)
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/proxy", nil)
+			if c.authorization != "" {
+				r.Header.Set("Authorization", c.authorization)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			if got := rr.Header().Get("WWW-Authenticate"); got != c.challenge {
+				t.Errorf("expected challenges to match; got: %q, want: %q", got, c.challenge)
+			}
+		})
+	}
+}
+func TestFromContextWithoutToken(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	if _, ok := tokenFromContext(r.Context()); ok {
+		t.Error("expected no token in an empty context")
+	}
+	if _, ok := claimsFromContext(r.Context()); ok {
+		t.Error("expected no claims in an empty context")
+	}
+}
+
+func TestWithScope(t *testing.T) {
+	type testCase struct {
+		name       string
+		token      *rvAuth.Token
+		statusCode int
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "no token",
+			statusCode: http.StatusUnauthorized,
+		},
+		testCase{
+			name:       "missing scope",
+			token:      newTestToken("valid-token", "unit-test", "read:other"),
+			statusCode: http.StatusForbidden,
+		},
+		testCase{
+			name:       "granted scope",
+			token:      newTestToken("valid-token", "unit-test", "read:other read:proxy"),
+			statusCode: http.StatusOK,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := withScope(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), "read:proxy", log.NewNopLogger(), nil)
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/proxy", nil)
+			if c.token != nil {
+				r = r.WithContext(context.WithValue(r.Context(), contextKeyToken, c.token))
+			}
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.statusCode)
+			}
+		})
+	}
+}
+
+func TestAuthLogs(t *testing.T) {
+	type testCase struct {
+		name          string
+		authorization string
+		scope         string
+		logged        []string
+		notLogged     []string
+	}
+
+	// A JWT for the subject unit-test, it is never verified
+	unverified := "eyJhbGciOiJIUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"unit-test"}`)) + ".c2lnbmF0dXJl"
+
+	cases := []testCase{
+		testCase{
+			name:          "invalid token",
+			authorization: "Bearer " + unverified,
+			logged:        []string{"sub=unit-test", `msg="invalid bearer token"`},
+			notLogged:     []string{unverified},
+		},
+		testCase{
+			name:          "missing scope",
+			authorization: "Bearer valid-token",
+			scope:         "write:proxy",
+			logged:        []string{"sub=unit-test", "scope=write:proxy", `scopes="read:proxy read:other"`},
+			notLogged:     []string{"valid-token"},
+		},
+	}
+
+	v := fakeVerifier{
+		"valid-token": newTestToken("valid-token", "unit-test", "read:proxy read:other"),
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := log.NewLogfmtLogger(&buf)
+
+			var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			if c.scope != "" {
+				h = withScope(h, c.scope, l, nil)
+			}
+			h = withJWT(h, v, l, nil)
+			h = withBearerToken(h, "", "", nil)
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/proxy", nil)
+			r.Header.Set("Authorization", c.authorization)
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			for _, s := range c.logged {
+				if !strings.Contains(buf.String(), s) {
+					t.Errorf("expected %s to be logged; got: %q", s, buf.String())
+				}
+			}
+			for _, s := range c.notLogged {
+				if strings.Contains(buf.String(), s) {
+					t.Errorf("expected %s not to be logged; got: %q", s, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestTokenLogFields(t *testing.T) {
+	type testCase struct {
+		name      string
+		token     *rvAuth.Token
+		logged    []string
+		notLogged []string
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"unit-test","org_id":"org-123","azp":"client-456"}`))
+	raw := "eyJhbGciOiJSUzI1NiJ9." + payload + ".c2lnbmF0dXJl"
+
+	cases := []testCase{
+		testCase{
+			name:      "verified token",
+			token:     newTestToken(raw, "unit-test", "write:proxy"),
+			logged:    []string{"sub=unit-test", "org_id=org-123", "azp=client-456"},
+			notLogged: []string{payload},
+		},
+		testCase{
+			name:      "only a subject",
+			token:     newTestToken("eyJhbGciOiJSUzI1NiJ9.e30.c2lnbmF0dXJl", "unit-test", "write:proxy"),
+			logged:    []string{"sub=unit-test"},
+			notLogged: []string{"org_id", "azp"},
+		},
+		testCase{
+			name:      "no token",
+			notLogged: []string{"sub", "org_id", "azp"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer upstream.Close()
+
+			var buf bytes.Buffer
+			h := handler{
+				l:              log.NewLogfmtLogger(&buf),
+				optionProxyURL: upstream.URL,
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/proxy", nil)
+			if c.token != nil {
+				r = r.WithContext(context.WithValue(r.Context(), contextKeyToken, c.token))
+			}
+			h.proxyHandler(httptest.NewRecorder(), r)
+
+			for _, s := range c.logged {
+				if !strings.Contains(buf.String(), s) {
+					t.Errorf("expected %q to be logged; got: %s", s, buf.String())
+				}
+			}
+			for _, s := range c.notLogged {
+				if strings.Contains(buf.String(), s) {
+					t.Errorf("expected %q not to be logged; got: %s", s, buf.String())
+				}
+			}
+		})
+	}
+}
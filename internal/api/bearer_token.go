@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+const (
+	contextKeyBearerToken contextKey = "bearerToken"
+	contextKeyAuthScheme  contextKey = "authScheme"
+)
+
+const (
+	defaultAuthHeader = "Authorization"
+	defaultAuthScheme = "Bearer"
+)
+
+// bearerTokenFromContext returns the raw bearer token parsed by
+// withBearerToken.
+func bearerTokenFromContext(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(contextKeyBearerToken).(string)
+	return token, ok && token != ""
+}
+
+// setAuthChallenge sets the WWW-Authenticate header of a 401 to a challenge
+// for the scheme withBearerToken reads tokens with, followed by params such as
+// error="invalid_token" when there are any. The challenge is for Bearer when
+// there is no scheme, as when the token is the whole of a custom header.
+func setAuthChallenge(w http.ResponseWriter, r *http.Request, params string) {
+	scheme, _ := r.Context().Value(contextKeyAuthScheme).(string)
+	if scheme == "" {
+		scheme = defaultAuthScheme
+	}
+
+	challenge := scheme
+	if params != "" {
+		challenge += " " + params
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+}
+
+// parseAuthToken returns the token from a header value of the form
+// "<scheme> <token>", such as "Bearer <token>". The scheme is matched
+// case-insensitively, as RFC 7235 has it, and the token must be a single word.
+// The whole value is the token when scheme is empty.
+func parseAuthToken(value, scheme string) (string, bool) {
+	token := value
+	if scheme != "" {
+		i := strings.IndexByte(value, ' ')
+		if i < 0 || !strings.EqualFold(value[:i], scheme) {
+			return "", false
+		}
+		token = value[i+1:]
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" || strings.ContainsAny(token, " \t") {
+		return "", false
+	}
+	return token, true
+}
+
+// withBearerToken parses the token from the header once for the auth
+// middleware after it, storing it in the request context so that it can be
+// read with bearerTokenFromContext. The header defaults to Authorization, and
+// scheme to Bearer when it does, but edges like gRPC-Web can send the token
+// under a scheme of their own or as the whole of a custom header. A header that
+// isn't a well-formed token is a 401, and counted in m. Requests without the
+// header are let through without a token, which leaves it to withJWT to
+// require one. The scheme is kept in the request context too, so that every
+// 401 challenges the client with it through setAuthChallenge.
+func withBearerToken(next http.Handler, header, scheme string, m *AuthMetrics) http.Handler {
+	if header == "" {
+		header = defaultAuthHeader
+		if scheme == "" {
+			scheme = defaultAuthScheme
+		}
+	}
+
+	msg := "the " + header + " header must be a token"
+	if scheme != "" {
+		msg = "the " + header + " header must be a " + scheme + " token"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(context.WithValue(r.Context(), contextKeyAuthScheme, scheme))
+
+		value := r.Header.Get(header)
+		if value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := parseAuthToken(value, scheme)
+		if !ok {
+			m.observe(authOutcomeInvalidToken)
+			setAuthChallenge(w, r, `error="invalid_request"`)
+			sendError(w, r, http.StatusUnauthorized, msg)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), contextKeyBearerToken, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithBearerToken(t *testing.T) {
+	type testCase struct {
+		name          string
+		header        string
+		scheme        string
+		authorization string
+		statusCode    int
+		token         string
+	}
+
+	cases := []testCase{
+		testCase{
+			name:          "well formed",
+			authorization: "Bearer unit-test",
+			statusCode:    http.StatusOK,
+			token:         "unit-test",
+		},
+		testCase{
+			name:          "lowercase scheme",
+			authorization: "bearer unit-test",
+			statusCode:    http.StatusOK,
+			token:         "unit-test",
+		},
+		testCase{
+			name:          "extra spaces",
+			authorization: "Bearer   unit-test ",
+			statusCode:    http.StatusOK,
+			token:         "unit-test",
+		},
+		testCase{
+			name:       "missing header",
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:          "missing token",
+			authorization: "Bearer ",
+			statusCode:    http.StatusUnauthorized,
+		},
+		testCase{
+			name:          "missing scheme",
+			authorization: "unit-test",
+			statusCode:    http.StatusUnauthorized,
+		},
+		testCase{
+			name:          "other scheme",
+			authorization: "Basic dW5pdC10ZXN0Og==",
+			statusCode:    http.StatusUnauthorized,
+		},
+		testCase{
+			name:          "more than one token",
+			authorization: "Bearer unit test",
+			statusCode:    http.StatusUnauthorized,
+		},
+		testCase{
+			name:          "custom scheme",
+			scheme:        "Grpc-Token",
+			authorization: "grpc-token unit-test",
+			statusCode:    http.StatusOK,
+			token:         "unit-test",
+		},
+		testCase{
+			name:          "bearer with a custom scheme",
+			scheme:        "Grpc-Token",
+			authorization: "Bearer unit-test",
+			statusCode:    http.StatusUnauthorized,
+		},
+		testCase{
+			name:          "custom header",
+			header:        "X-Grpc-Web-Token",
+			authorization: "unit-test",
+			statusCode:    http.StatusOK,
+			token:         "unit-test",
+		},
+		testCase{
+			name:          "custom header with a scheme",
+			header:        "X-Grpc-Web-Token",
+			scheme:        "Bearer",
+			authorization: "Bearer unit-test",
+			statusCode:    http.StatusOK,
+			token:         "unit-test",
+		},
+		testCase{
+			name:          "custom header with more than one token",
+			header:        "X-Grpc-Web-Token",
+			authorization: "unit test",
+			statusCode:    http.StatusUnauthorized,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var token string
+			h := withBearerToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				token, _ = bearerTokenFromContext(r.Context())
+			}), c.header, c.scheme, nil)
+
+			header := c.header
+			if header == "" {
+				header = "Authorization"
+			}
+			r := httptest.NewRequest(http.MethodPost, "/v1/proxy", nil)
+			if c.authorization != "" {
+				r.Header.Set(header, c.authorization)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.statusCode)
+			}
+			scheme := c.scheme
+			if scheme == "" {
+				scheme = "Bearer"
+			}
+			if got := rr.Header().Get("WWW-Authenticate"); c.statusCode != http.StatusOK && !strings.HasPrefix(got, scheme+" ") {
+				t.Errorf("expected a %s challenge; got: %q", scheme, got)
+			}
+			if token != c.token {
+				t.Errorf("expected tokens to match; got: %q, want: %q", token, c.token)
+			}
+		})
+	}
+}
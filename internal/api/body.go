@@ -0,0 +1,82 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// bufferBody reads the whole request body, replacing it with a copy so that
+// next can still read it. Bodies bigger than max bytes are rejected with a
+// 413 and unreadable ones with a 400, in which case it reports false and
+// nothing more should be written. There is no limit when max is zero.
+func bufferBody(w http.ResponseWriter, r *http.Request, max int64) ([]byte, bool) {
+	b, err := ioutil.ReadAll(limitBody(r.Body, max))
+	r.Body.Close()
+	if isBodyTooLarge(err) {
+		sendError(w, r, http.StatusRequestEntityTooLarge, err.Error())
+		return nil, false
+	}
+	if err != nil {
+		sendError(w, r, http.StatusBadRequest, "could not read request body")
+		return nil, false
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return b, true
+}
+
+// limitBody returns body with reads past max bytes failing with a
+// bodyTooLargeError. It returns body as it is when max is zero.
+func limitBody(body io.ReadCloser, max int64) io.ReadCloser {
+	if max <= 0 {
+		return body
+	}
+	return &maxBytesBody{ReadCloser: body, max: max}
+}
+
+// maxBytesBody is like http.MaxBytesReader, with an error that can be told
+// apart from any other failed read.
+type maxBytesBody struct {
+	io.ReadCloser
+	max  int64
+	read int64
+}
+
+func (b *maxBytesBody) Read(p []byte) (int, error) {
+	if b.read > b.max {
+		return 0, bodyTooLargeError{max: b.max}
+	}
+
+	// Read at most one byte past the limit, which is enough to tell that the
+	// body is too large
+	if left := b.max - b.read + 1; int64(len(p)) > left {
+		p = p[:left]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if b.read > b.max {
+		return n - int(b.read-b.max), bodyTooLargeError{max: b.max}
+	}
+	return n, err
+}
+
+// bodyTooLargeError is returned when a request body turns out to be bigger
+// than we are willing to read.
+type bodyTooLargeError struct {
+	max int64
+}
+
+func (e bodyTooLargeError) Error() string {
+	return fmt.Sprintf("request body is larger than %d bytes", e.max)
+}
+
+// isBodyTooLarge reports whether err came from a request body that is too
+// large, which should be answered with a 413.
+func isBodyTooLarge(err error) bool {
+	var tooLarge bodyTooLargeError
+	return errors.As(err, &tooLarge)
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBufferBody(t *testing.T) {
+	type testCase struct {
+		name       string
+		body       string
+		max        int64
+		ok         bool
+		statusCode int
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "no limit",
+			body:       `{"unit":"test"}`,
+			ok:         true,
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "at the limit",
+			body:       `{"unit":"test"}`,
+			max:        int64(len(`{"unit":"test"}`)),
+			ok:         true,
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "too large",
+			body:       `{"unit":"test"}`,
+			max:        4,
+			statusCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/v1/proxy", strings.NewReader(c.body))
+			w := httptest.NewRecorder()
+
+			b, ok := bufferBody(w, r, c.max)
+			if ok != c.ok {
+				t.Fatalf("expected the body to be read: %v", c.ok)
+			}
+			if w.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", w.Code, c.statusCode)
+			}
+			if !ok {
+				return
+			}
+
+			if string(b) != c.body {
+				t.Errorf("expected bodies to match; got: %q, want: %q", b, c.body)
+			}
+			if again, _ := ioutil.ReadAll(r.Body); string(again) != c.body {
+				t.Errorf("expected the body to still be readable; got: %q, want: %q", again, c.body)
+			}
+		})
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	body := limitBody(ioutil.NopCloser(strings.NewReader("unit-test")), 4)
+
+	b, err := ioutil.ReadAll(body)
+	if !isBodyTooLarge(err) {
+		t.Errorf("expected a body too large error; got: %v", err)
+	}
+	if string(b) != "unit" {
+		t.Errorf("expected only the limit to be read; got: %q", b)
+	}
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const contextKeyBudgetDeadline contextKey = "budgetDeadline"
+
+// withBudget gives every request a time budget of d, storing its deadline in
+// the request context so that handlers can check what is left of it with
+// Budget. Unlike withTimeout nothing is cancelled when it runs out; it is only
+// there to help handlers decide whether more work is worth starting.
+func withBudget(next http.Handler, d time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), contextKeyBudgetDeadline, time.Now().Add(d))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Budget returns the time left to serve the request ctx belongs to, which is
+// the sooner of the deadline set by withBudget and the context's own deadline.
+// It is false when there is neither. The time left is negative once the budget
+// has been spent.
+func Budget(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Value(contextKeyBudgetDeadline).(time.Time)
+	if ctxDeadline, hasDeadline := ctx.Deadline(); hasDeadline && (!ok || ctxDeadline.Before(deadline)) {
+		deadline, ok = ctxDeadline, true
+	}
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithBudget(t *testing.T) {
+	var first, second time.Duration
+	var ok bool
+	h := withBudget(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		first, ok = Budget(r.Context())
+		time.Sleep(10 * time.Millisecond)
+		second, _ = Budget(r.Context())
+	}), time.Second)
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/proxy", nil)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if !ok {
+		t.Fatal("expected a budget in context")
+	}
+	if first <= 0 || first > time.Second {
+		t.Errorf("expected the budget to start at up to a second; got: %v", first)
+	}
+	if first-second < 10*time.Millisecond {
+		t.Errorf("expected the budget to decrease over the request; got: %v, then %v", first, second)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	type testCase struct {
+		name    string
+		budget  time.Duration
+		timeout time.Duration
+		ok      bool
+		atMost  time.Duration
+		atLeast time.Duration
+	}
+
+	cases := []testCase{
+		testCase{
+			name: "neither",
+		},
+		testCase{
+			name:    "budget",
+			budget:  time.Minute,
+			ok:      true,
+			atMost:  time.Minute,
+			atLeast: 59 * time.Second,
+		},
+		testCase{
+			name:    "context deadline",
+			timeout: time.Minute,
+			ok:      true,
+			atMost:  time.Minute,
+			atLeast: 59 * time.Second,
+		},
+		testCase{
+			name:    "context deadline sooner than budget",
+			budget:  time.Hour,
+			timeout: time.Minute,
+			ok:      true,
+			atMost:  time.Minute,
+			atLeast: 59 * time.Second,
+		},
+		testCase{
+			name:    "budget sooner than context deadline",
+			budget:  time.Minute,
+			timeout: time.Hour,
+			ok:      true,
+			atMost:  time.Minute,
+			atLeast: 59 * time.Second,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			if c.budget > 0 {
+				ctx = context.WithValue(ctx, contextKeyBudgetDeadline, time.Now().Add(c.budget))
+			}
+			if c.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, c.timeout)
+				defer cancel()
+			}
+
+			got, ok := Budget(ctx)
+			if ok != c.ok {
+				t.Fatalf("expected a budget only when there is a deadline; got: %v", ok)
+			}
+			if got > c.atMost || got < c.atLeast {
+				t.Errorf("expected the budget to be between %v and %v; got: %v", c.atLeast, c.atMost, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	rvAuth "github.com/RedVentures/sdk-go/auth"
+	"github.com/go-kit/kit/log"
+)
+
+var (
+	errCertificateRequired = errors.New("token is bound to a client certificate")
+	errCertificateMismatch = errors.New("token is bound to a different client certificate")
+)
+
+// confirmation is the cnf claim of a sender-constrained token (RFC 8705).
+type confirmation struct {
+	// X5tS256 is the base64url encoded SHA-256 thumbprint of the client
+	// certificate the token is bound to.
+	X5tS256 string `json:"x5t#S256"`
+}
+
+// tokenConfirmation decodes the cnf claim of token, which is empty when the
+// token isn't bound to anything.
+func tokenConfirmation(token *rvAuth.Token) (confirmation, error) {
+	var claims struct {
+		Confirmation confirmation `json:"cnf"`
+	}
+	err := decodeClaims(token.Raw, &claims)
+	return claims.Confirmation, err
+}
+
+// verifyCertBinding checks that a token with cnf was presented over a TLS
+// connection, described by state, with the client certificate it is bound to.
+// Tokens that aren't bound to a certificate are always allowed.
+func verifyCertBinding(cnf confirmation, state *tls.ConnectionState) error {
+	if cnf.X5tS256 == "" {
+		return nil
+	}
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return errCertificateRequired
+	}
+
+	sum := sha256.Sum256(state.PeerCertificates[0].Raw)
+	presented := base64.RawURLEncoding.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(presented), []byte(cnf.X5tS256)) != 1 {
+		return errCertificateMismatch
+	}
+	return nil
+}
+
+// withCertBinding rejects sender-constrained tokens unless they are presented
+// over a TLS connection with the client certificate they are bound to. See
+// verifyCertBinding. It must run after withJWT.
+func withCertBinding(next http.Handler, l log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := tokenFromContext(r.Context())
+		if !ok {
+			sendError(w, r, http.StatusUnauthorized, "a bearer token is required")
+			return
+		}
+
+		cnf, err := tokenConfirmation(token)
+		if err != nil {
+			setAuthChallenge(w, r, `error="invalid_token"`)
+			sendError(w, r, http.StatusUnauthorized, "invalid bearer token")
+			return
+		}
+
+		if err := verifyCertBinding(cnf, r.TLS); err != nil {
+			l.Log("level", "warn", "msg", "rejected certificate bound token", "sub", token.Claims.Subject, "err", err.Error())
+			setAuthChallenge(w, r, `error="invalid_token"`)
+			sendError(w, r, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ValidateCertBinding checks that certificate bound tokens are only required
+// when the server is served over TLS, as there is no client certificate to
+// check them against otherwise.
+func ValidateCertBinding(certBound bool, tlsConfig *tls.Config) error {
+	if certBound && tlsConfig == nil {
+		return errors.New("certificate bound tokens require the server to be served over TLS")
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestVerifyCertBinding(t *testing.T) {
+	type testCase struct {
+		name  string
+		cnf   confirmation
+		state *tls.ConnectionState
+		err   error
+	}
+
+	sum := sha256.Sum256([]byte("unit-test-cert"))
+	bound := confirmation{X5tS256: base64.RawURLEncoding.EncodeToString(sum[:])}
+	withCert := func(raw string) *tls.ConnectionState {
+		return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{&x509.Certificate{Raw: []byte(raw)}}}
+	}
+
+	cases := []testCase{
+		testCase{
+			name: "unbound token over plain http",
+		},
+		testCase{
+			name:  "unbound token with a certificate",
+			state: withCert("unit-test-cert"),
+		},
+		testCase{
+			name:  "matching certificate",
+			cnf:   bound,
+			state: withCert("unit-test-cert"),
+		},
+		testCase{
+			name:  "mismatching certificate",
+			cnf:   bound,
+			state: withCert("other-cert"),
+			err:   errCertificateMismatch,
+		},
+		testCase{
+			name:  "tls without a client certificate",
+			cnf:   bound,
+			state: &tls.ConnectionState{},
+			err:   errCertificateRequired,
+		},
+		testCase{
+			name: "plain http",
+			cnf:  bound,
+			err:  errCertificateRequired,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := verifyCertBinding(c.cnf, c.state); err != c.err {
+				t.Errorf("expected errors to match; got: %v, want %v", err, c.err)
+			}
+		})
+	}
+}
+
+func TestTokenConfirmation(t *testing.T) {
+	raw := "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(`{"cnf":{"x5t#S256":"unit-test"}}`)) + ".c2lnbmF0dXJl"
+
+	cnf, err := tokenConfirmation(newTestToken(raw, "unit-test", ""))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if cnf.X5tS256 != "unit-test" {
+		t.Errorf("expected thumbprints to match; got: %q, want %q", cnf.X5tS256, "unit-test")
+	}
+
+	if _, err := tokenConfirmation(newTestToken("valid-token", "unit-test", "")); err == nil {
+		t.Error("expected an error for a token that isn't a JWT")
+	}
+}
+
+func TestValidateCertBinding(t *testing.T) {
+	if err := ValidateCertBinding(true, nil); err == nil {
+		t.Error("expected an error for certificate bound tokens over plain http")
+	}
+	if err := ValidateCertBinding(true, &tls.Config{}); err != nil {
+		t.Errorf("expected no error; got: %v", err)
+	}
+	if err := ValidateCertBinding(false, nil); err != nil {
+		t.Errorf("expected no error; got: %v", err)
+	}
+}
+
+func TestWithCertBinding(t *testing.T) {
+	type testCase struct {
+		name       string
+		cnf        map[string]interface{}
+		cert       []byte
+		statusCode int
+	}
+
+	sum := sha256.Sum256([]byte("unit-test-cert"))
+	thumbprint := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	cases := []testCase{
+		testCase{
+			name:       "unbound token",
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "matching certificate",
+			cnf:        map[string]interface{}{"x5t#S256": thumbprint},
+			cert:       []byte("unit-test-cert"),
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "mismatching certificate",
+			cnf:        map[string]interface{}{"x5t#S256": thumbprint},
+			cert:       []byte("other-cert"),
+			statusCode: http.StatusUnauthorized,
+		},
+		testCase{
+			name:       "no client certificate",
+			cnf:        map[string]interface{}{"x5t#S256": thumbprint},
+			statusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			claims := map[string]interface{}{"sub": "unit-test"}
+			if c.cnf != nil {
+				claims["cnf"] = c.cnf
+			}
+			payload, _ := json.Marshal(claims)
+			raw := "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(payload) + ".c2lnbmF0dXJl"
+
+			h := withBearerToken(withJWT(withCertBinding(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), log.NewNopLogger()),
+				fakeVerifier{"valid-token": newTestToken(raw, "unit-test", "")}, log.NewNopLogger(), nil), "", "", nil)
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/proxy", nil)
+			r.Header.Set("Authorization", "Bearer valid-token")
+			if c.cert != nil {
+				r.TLS = &tls.ConnectionState{
+					PeerCertificates: []*x509.Certificate{&x509.Certificate{Raw: c.cert}},
+				}
+			}
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.statusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// errCircuitOpen is returned instead of making a request while the circuit is
+// open.
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+// circuitState is the state of a circuitBreaker. The values are exported as
+// the circuit state metric, so they must not change.
+type circuitState int
+
+const (
+	// circuitClosed lets every request through.
+	circuitClosed circuitState = iota
+
+	// circuitOpen fails every request without making it.
+	circuitOpen
+
+	// circuitHalfOpen lets a single trial request through to decide whether to
+	// close the circuit again.
+	circuitHalfOpen
+)
+
+// circuitBreaker is an http.RoundTripper that stops making requests after
+// threshold consecutive failures, so that an outage of the service it talks
+// to (such as Auth0) isn't made worse by every caller retrying. After cooldown
+// a single request is let through, closing the circuit if it succeeds.
+type circuitBreaker struct {
+	next      http.RoundTripper
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mutex    sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+}
+
+// newCircuitBreaker wraps next, or http.DefaultTransport if it is nil.
+func newCircuitBreaker(next http.RoundTripper, threshold int, cooldown time.Duration) *circuitBreaker {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &circuitBreaker{
+		next:      next,
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// NewAuthClient creates the client used to call Auth0. It stops calling Auth0
+// for cooldown after threshold consecutive failures, rather than piling on, and
+// reports the state of the circuit to reg. Auth0 has 30s to respond, which is
+// enforced by the transport rather than a client timeout, since the client's
+// would look to the breaker like any other caller giving up.
+func NewAuthClient(threshold int, cooldown time.Duration, reg prometheus.Registerer) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = 30 * time.Second
+
+	cb := newCircuitBreaker(transport, threshold, cooldown)
+	_, err := register(reg, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "auth_circuit_state",
+		Help: "State of the circuit breaker for calls to Auth0, 0 is closed, 1 is open and 2 is half open",
+	}, func() float64 { return float64(cb.State()) }))
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Transport: cb,
+	}, nil
+}
+
+func (cb *circuitBreaker) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !cb.allow() {
+		return nil, errCircuitOpen
+	}
+
+	resp, err := cb.next.RoundTrip(r)
+	if err != nil && r.Context().Err() != nil {
+		// The caller was cancelled or ran out of time, which says nothing
+		// about the service
+		cb.abandon()
+		return resp, err
+	}
+	cb.record(err == nil && resp.StatusCode < http.StatusInternalServerError)
+
+	return resp, err
+}
+
+// State is the current state of the circuit.
+func (cb *circuitBreaker) State() circuitState {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	return cb.state
+}
+
+// allow reports whether a request can be made, moving an open circuit to half
+// open once the cooldown has passed.
+func (cb *circuitBreaker) allow() bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	switch cb.state {
+	case circuitOpen:
+		if cb.now().Sub(cb.openedAt) < cb.cooldown {
+			return false
+		}
+		cb.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		// Only the trial request is let through
+		return false
+	}
+	return true
+}
+
+// abandon gives up on a request allowed through without recording whether it
+// failed. A trial request that was given up on puts the circuit back to open,
+// rather than leaving it half open for good, and the next request after it
+// becomes the trial instead.
+func (cb *circuitBreaker) abandon() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.state == circuitHalfOpen {
+		cb.state = circuitOpen
+	}
+}
+
+func (cb *circuitBreaker) record(success bool) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if success {
+		cb.state = circuitClosed
+		cb.failures = 0
+		return
+	}
+
+	cb.failures++
+	if cb.state == circuitHalfOpen || cb.failures >= cb.threshold {
+		cb.state = circuitOpen
+		cb.openedAt = cb.now()
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	failing := true
+	calls := 0
+	auth0 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer auth0.Close()
+
+	now := time.Now()
+	cb := newCircuitBreaker(nil, 2, time.Minute)
+	cb.now = func() time.Time { return now }
+	client := &http.Client{Transport: cb}
+
+	get := func() error {
+		resp, err := client.Get(auth0.URL + "/.well-known/jwks.json")
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// Trip the breaker with consecutive failures
+	for i := 0; i < 2; i++ {
+		if err := get(); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if cb.State() != circuitOpen {
+		t.Fatalf("expected the circuit to open; got: %v", cb.State())
+	}
+
+	// Requests fail fast without reaching Auth0 while open
+	if err := get(); err == nil {
+		t.Error("expected an error while the circuit is open")
+	}
+	if calls != 2 {
+		t.Errorf("expected no calls while open; got: %v, want: %v", calls, 2)
+	}
+
+	// A failed trial after the cooldown opens it again
+	now = now.Add(time.Minute)
+	get()
+	if cb.State() != circuitOpen {
+		t.Errorf("expected a failed trial to reopen the circuit; got: %v", cb.State())
+	}
+
+	// A successful trial closes it
+	now = now.Add(time.Minute)
+	failing = false
+	if err := get(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if cb.State() != circuitClosed {
+		t.Errorf("expected a successful trial to close the circuit; got: %v", cb.State())
+	}
+	if calls != 4 {
+		t.Errorf("expected each trial to reach Auth0; got: %v, want: %v", calls, 4)
+	}
+}
+
+func TestCircuitBreakerCallerGivesUp(t *testing.T) {
+	release := make(chan struct{})
+	auth0 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer auth0.Close()
+	defer close(release)
+
+	now := time.Now()
+	cb := newCircuitBreaker(nil, 1, time.Minute)
+	cb.now = func() time.Time { return now }
+	client := &http.Client{Transport: cb}
+
+	get := func(ctx context.Context) error {
+		r, err := http.NewRequest(http.MethodGet, auth0.URL+"/.well-known/jwks.json", nil)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		resp, err := client.Do(r.WithContext(ctx))
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	for _, ctx := range []context.Context{cancelled, expired} {
+		if err := get(ctx); err == nil {
+			t.Fatal("expected the request to be given up on")
+		}
+		if cb.State() != circuitClosed {
+			t.Errorf("expected the circuit to stay closed; got: %v", cb.State())
+		}
+	}
+
+	// A trial that is given up on leaves the next request to be the trial
+	cb.record(false)
+	now = now.Add(time.Minute)
+	get(cancelled)
+	if cb.State() != circuitOpen {
+		t.Errorf("expected the circuit to be open again; got: %v", cb.State())
+	}
+	if !cb.allow() {
+		t.Error("expected the next request to be let through as the trial")
+	}
+}
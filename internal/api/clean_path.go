@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// withCleanPath collapses duplicate slashes and strips the trailing slash from
+// the request path before it is routed, so that /v1/proxy/ matches /v1/proxy.
+// When redirect is set, GET and HEAD requests are instead redirected to the
+// canonical path with a 301.
+func withCleanPath(next http.Handler, redirect bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clean := cleanPath(r.URL.Path)
+		if clean == r.URL.Path {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if redirect && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			u := *r.URL
+			u.Path = clean
+			u.RawPath = ""
+			http.Redirect(w, r, u.RequestURI(), http.StatusMovedPermanently)
+			return
+		}
+
+		// Copy the URL so that we don't change the caller's request
+		u := *r.URL
+		u.Path = clean
+		u.RawPath = ""
+		r2 := *r
+		r2.URL = &u
+
+		next.ServeHTTP(w, &r2)
+	})
+}
+
+// cleanPath collapses duplicate slashes and removes any trailing slash, unless
+// the path is the root.
+func cleanPath(p string) string {
+	var b strings.Builder
+	b.Grow(len(p))
+
+	for i := 0; i < len(p); i++ {
+		if p[i] == '/' && b.Len() > 0 && p[i-1] == '/' {
+			continue
+		}
+		b.WriteByte(p[i])
+	}
+
+	clean := strings.TrimRight(b.String(), "/")
+	if !strings.HasPrefix(clean, "/") {
+		clean = "/" + clean
+	}
+	return clean
+}
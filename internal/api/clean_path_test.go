@@ -0,0 +1,97 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithCleanPath(t *testing.T) {
+	type testCase struct {
+		name       string
+		method     string
+		url        string
+		redirect   bool
+		statusCode int
+		path       string
+		location   string
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "already clean",
+			method:     http.MethodGet,
+			url:        "/v1/proxy",
+			redirect:   true,
+			statusCode: http.StatusOK,
+			path:       "/v1/proxy",
+		},
+		testCase{
+			name:       "root",
+			method:     http.MethodGet,
+			url:        "/",
+			redirect:   true,
+			statusCode: http.StatusOK,
+			path:       "/",
+		},
+		testCase{
+			name:       "doubled root",
+			method:     http.MethodPost,
+			url:        "//",
+			statusCode: http.StatusOK,
+			path:       "/",
+		},
+		testCase{
+			name:       "rewrite trailing slash",
+			method:     http.MethodPost,
+			url:        "/v1/proxy/",
+			statusCode: http.StatusOK,
+			path:       "/v1/proxy",
+		},
+		testCase{
+			name:       "rewrite duplicate slashes",
+			method:     http.MethodGet,
+			url:        "//v1///proxy//",
+			statusCode: http.StatusOK,
+			path:       "/v1/proxy",
+		},
+		testCase{
+			name:       "redirect",
+			method:     http.MethodGet,
+			url:        "/v1//proxy/?a=b",
+			redirect:   true,
+			statusCode: http.StatusMovedPermanently,
+			location:   "/v1/proxy?a=b",
+		},
+		testCase{
+			name:       "rewrite instead of redirecting a POST",
+			method:     http.MethodPost,
+			url:        "/v1/proxy/",
+			redirect:   true,
+			statusCode: http.StatusOK,
+			path:       "/v1/proxy",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var path string
+			h := withCleanPath(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+			}), c.redirect)
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(c.method, c.url, nil))
+
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.statusCode)
+			}
+			if path != c.path {
+				t.Errorf("expected paths to match; got: %q, want: %q", path, c.path)
+			}
+			if got := rr.Header().Get("Location"); got != c.location {
+				t.Errorf("expected locations to match; got: %q, want: %q", got, c.location)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/cors"
+)
+
+func TestWithCORS(t *testing.T) {
+	type testCase struct {
+		name       string
+		method     string
+		header     map[string]string
+		statusCode int
+		called     bool
+	}
+
+	cases := []testCase{
+		testCase{
+			name:   "preflight",
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin":                        "https://example.com",
+				"Access-Control-Request-Method": http.MethodPost,
+			},
+			statusCode: http.StatusNoContent,
+		},
+		testCase{
+			name:   "options without a requested method",
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin": "https://example.com",
+			},
+			statusCode: http.StatusTeapot,
+			called:     true,
+		},
+		testCase{
+			name:   "actual request",
+			method: http.MethodPost,
+			header: map[string]string{
+				"Origin": "https://example.com",
+			},
+			statusCode: http.StatusTeapot,
+			called:     true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var called bool
+			h := withCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.WriteHeader(http.StatusTeapot)
+			}), cors.AllowAll())
+
+			r := httptest.NewRequest(c.method, "/v1/proxy", nil)
+			for k, v := range c.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", w.Code, c.statusCode)
+			}
+			if called != c.called {
+				t.Errorf("expected next to be called to match; got: %v, want %v", called, c.called)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+				t.Errorf("expected cors headers to be set; got: %q, want: %q", got, "*")
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+type claimsResponse struct {
+	Claims        map[string]interface{} `json:"claims"`
+	ExpiresAt     string                 `json:"expiresAt,omitempty"`
+	ExpiresIn     int64                  `json:"expiresInSeconds"`
+	Audience      []string               `json:"audience"`
+	AudienceMatch bool                   `json:"audienceMatch"`
+}
+
+// ClaimsHandler verifies the presented bearer token with v and responds with
+// its claims, when it expires and whether it was issued for resource. It is
+// only for developers debugging their tokens, so it must only be served on the
+// internal metrics server.
+func ClaimsHandler(v Verifier, resource string, l log.Logger) http.Handler {
+	return withBearerToken(withJWT(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _ := tokenFromContext(r.Context())
+
+		raw, err := token.RawClaims()
+		if err != nil {
+			sendError(w, r, http.StatusInternalServerError, "could not decode claims")
+			return
+		}
+
+		resp := claimsResponse{
+			Claims:   raw,
+			Audience: []string{},
+		}
+		if token.Claims != nil {
+			if token.Claims.ExpiresAt != 0 {
+				exp := time.Unix(token.Claims.ExpiresAt, 0)
+				resp.ExpiresAt = exp.UTC().Format(time.RFC3339)
+				resp.ExpiresIn = int64(time.Until(exp).Seconds())
+			}
+			resp.Audience = append(resp.Audience, token.Claims.Audience...)
+			resp.AudienceMatch = containsString(token.Claims.Audience, resource)
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(resp)
+	}), v, l, nil), "", "", nil)
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	rvAuth "github.com/RedVentures/sdk-go/auth"
+	"github.com/go-kit/kit/log"
+)
+
+func TestClaimsHandler(t *testing.T) {
+	type testCase struct {
+		name       string
+		token      string
+		statusCode int
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "valid token",
+			token:      "valid-token",
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "invalid token",
+			token:      "invalid-token",
+			statusCode: http.StatusUnauthorized,
+		},
+	}
+
+	exp := time.Now().Add(time.Hour).Unix()
+	payload, _ := json.Marshal(map[string]interface{}{
+		"sub":   "unit-test",
+		"aud":   "https://unit-test",
+		"exp":   exp,
+		"scope": "read:proxy",
+	})
+	raw := "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(payload) + ".c2lnbmF0dXJl"
+
+	token := newTestToken(raw, "unit-test", "read:proxy")
+	token.Claims.Audience = rvAuth.AudienceList{"https://unit-test"}
+	token.Claims.ExpiresAt = exp
+
+	h := ClaimsHandler(fakeVerifier{"valid-token": token}, "https://unit-test", log.NewNopLogger())
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/debug/claims", nil)
+			r.Header.Set("Authorization", "Bearer "+c.token)
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.statusCode)
+			}
+			if c.statusCode != http.StatusOK {
+				return
+			}
+
+			var resp claimsResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err.Error())
+			}
+			if resp.Claims["sub"] != "unit-test" || resp.Claims["scope"] != "read:proxy" {
+				t.Errorf("expected the raw claims; got: %v", resp.Claims)
+			}
+			if !resp.AudienceMatch {
+				t.Errorf("expected the audience to match; got: %v", resp.Audience)
+			}
+			if resp.ExpiresIn <= 0 || resp.ExpiresIn > 3600 {
+				t.Errorf("expected the token to expire within the hour; got: %v seconds", resp.ExpiresIn)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+)
+
+// dryRunResponse is sent back instead of the upstream's response in dry run
+// mode, describing the request that would have been sent.
+type dryRunResponse struct {
+	Message   string `json:"message"`
+	Method    string `json:"method"`
+	URL       string `json:"url"`
+	BodyBytes int64  `json:"bodyBytes"`
+}
+
+// dryRun logs proxyReq to l and responds with a 200 describing it, without
+// sending it to the upstream. buf is the buffered body when there is one.
+func dryRun(w http.ResponseWriter, proxyReq *http.Request, buf *replayBuffer, l log.Logger) {
+	var size int64
+	if buf != nil {
+		size = buf.Size()
+	} else if proxyReq.Body != nil {
+		size, _ = io.Copy(ioutil.Discard, proxyReq.Body)
+	}
+
+	l.Log("level", "info", "msg", "dry run, not forwarding proxy request",
+		"method", proxyReq.Method,
+		"url", proxyReq.URL.String(),
+		"header", proxyReq.Header,
+		"bodyBytes", size,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dryRunResponse{
+		Message:   "dry run, the request was not forwarded",
+		Method:    proxyReq.Method,
+		URL:       proxyReq.URL.String(),
+		BodyBytes: size,
+	})
+}
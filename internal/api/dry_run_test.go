@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestProxyHandlerDryRun(t *testing.T) {
+	type testCase struct {
+		name    string
+		retries int
+	}
+
+	cases := []testCase{
+		testCase{
+			name: "streamed body",
+		},
+		testCase{
+			name:    "buffered body",
+			retries: 2,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var called bool
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			}))
+			defer upstream.Close()
+
+			h := handler{
+				l:                  log.NewNopLogger(),
+				optionProxyURL:     upstream.URL,
+				optionProxyDryRun:  true,
+				optionProxyRetries: c.retries,
+			}
+
+			w := httptest.NewRecorder()
+			h.proxyHandler(w, httptest.NewRequest(http.MethodPost, "/v1/proxy", strings.NewReader(`{"unit":"test"}`)))
+
+			if called {
+				t.Errorf("expected the upstream not to be called in dry run mode")
+			}
+			if w.Code != http.StatusOK {
+				t.Errorf("expected status codes to match; got: %v, want %v", w.Code, http.StatusOK)
+			}
+
+			var resp dryRunResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err.Error())
+			}
+			want := dryRunResponse{
+				Message:   "dry run, the request was not forwarded",
+				Method:    http.MethodPost,
+				URL:       upstream.URL,
+				BodyBytes: 15,
+			}
+			if resp != want {
+				t.Errorf("expected dry run responses to match; got: %+v, want: %+v", resp, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// apiError is the body of every error response, whichever middleware or
+// handler rejected the request.
+type apiError struct {
+	// Code is a machine readable version of the status, such as
+	// too_many_requests.
+	Code      string            `json:"code,omitempty"`
+	Message   string            `json:"message,omitempty"`
+	Errors    []errorValidation `json:"errors,omitempty"`
+	RequestID string            `json:"requestId,omitempty"`
+}
+
+// sendError responds with status and an apiError for msg, carrying the
+// request's trace ID so that the error can be found in the logs.
+func sendError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	writeError(w, r, status, apiError{
+		Code:    errorCode(status),
+		Message: msg,
+	})
+}
+
+// sendValidationErrors responds with a 400 Bad Request listing every field
+// that failed validation.
+func sendValidationErrors(w http.ResponseWriter, r *http.Request, errs []errorValidation) {
+	writeError(w, r, http.StatusBadRequest, apiError{
+		Code:    "validation_failed",
+		Message: "request failed validation",
+		Errors:  errs,
+	})
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, err apiError) {
+	if tc, ok := traceContextFromContext(r.Context()); ok {
+		err.RequestID = tc.TraceID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(err)
+}
+
+// errorCode turns status into a code like too_many_requests.
+func errorCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		case r == ' ' || r == '-':
+			return '_'
+		}
+		return -1
+	}, text)
+}
+
+// notFoundHandler and methodNotAllowedHandler respond to requests the router
+// has no route for with an apiError rather than plain text.
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	sendError(w, r, http.StatusNotFound, "no route for "+r.URL.Path)
+}
+
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	sendError(w, r, http.StatusMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+}
+
+// ErrorValidation will return a nice JSON response when sent back to the user.
+// We should use this when sending error responses back over HTTP and should
+// usually be occupanied by 400 Bad Request
+type errorValidation struct {
+	// Field is the field that caused the validation error
+	Field string `json:"field"`
+
+	// Reason is the reason the field is invalid.
+	Reason string `json:"reason"`
+}
+
+// Error implements the error interface so that we can return this error from
+// functions in a nice mannor.
+func (e errorValidation) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Reason)
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSendError(t *testing.T) {
+	type testCase struct {
+		name       string
+		err        string
+		statusCode int
+		traced     bool
+		resp       apiError
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "internal server error",
+			err:        "unit-test",
+			statusCode: http.StatusInternalServerError,
+			resp: apiError{
+				Code:    "internal_server_error",
+				Message: "unit-test",
+			},
+		},
+		testCase{
+			name:       "traced",
+			err:        "unit-test",
+			statusCode: http.StatusTooManyRequests,
+			traced:     true,
+			resp: apiError{
+				Code:      "too_many_requests",
+				Message:   "unit-test",
+				RequestID: "4bf92f3577b34da6a3ce929d0e0e4736",
+			},
+		},
+		testCase{
+			name:       "unknown status",
+			err:        "unit-test",
+			statusCode: 599,
+			resp: apiError{
+				Code:    "error",
+				Message: "unit-test",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/proxy", nil)
+			if c.traced {
+				r = r.WithContext(context.WithValue(r.Context(), contextKeyTraceContext, traceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736"}))
+			}
+
+			rr := httptest.NewRecorder()
+			sendError(rr, r, c.statusCode, c.err)
+
+			var resp apiError
+			err := json.NewDecoder(rr.Body).Decode(&resp)
+			if err != nil {
+				t.Error(err.Error())
+			}
+
+			if !reflect.DeepEqual(resp, c.resp) {
+				t.Errorf("expected responses to match; got: %v, want: %v", resp, c.resp)
+			}
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.statusCode)
+			}
+			if got := rr.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("expected content types to match; got: %q, want: %q", got, "application/json")
+			}
+		})
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	cases := map[int]string{
+		http.StatusUnauthorized:          "unauthorized",
+		http.StatusForbidden:             "forbidden",
+		http.StatusRequestEntityTooLarge: "request_entity_too_large",
+		http.StatusUnsupportedMediaType:  "unsupported_media_type",
+		http.StatusTooManyRequests:       "too_many_requests",
+		http.StatusTeapot:                "im_a_teapot",
+	}
+
+	for status, want := range cases {
+		if got := errorCode(status); got != want {
+			t.Errorf("expected codes to match for %d; got: %q, want: %q", status, got, want)
+		}
+	}
+}
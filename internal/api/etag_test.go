@@ -0,0 +1,139 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestWithETag(t *testing.T) {
+	type testCase struct {
+		name        string
+		method      string
+		ifNoneMatch string
+		status      int
+		stream      bool
+		statusCode  int
+		etag        bool
+		body        string
+	}
+
+	body := `{"message":"unit-test"}`
+	sum := sha256.Sum256([]byte(body))
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	cases := []testCase{
+		testCase{
+			name:       "no if-none-match",
+			method:     http.MethodGet,
+			status:     http.StatusOK,
+			statusCode: http.StatusOK,
+			etag:       true,
+			body:       body,
+		},
+		testCase{
+			name:        "mismatch",
+			method:      http.MethodGet,
+			ifNoneMatch: `"stale"`,
+			status:      http.StatusOK,
+			statusCode:  http.StatusOK,
+			etag:        true,
+			body:        body,
+		},
+		testCase{
+			name:        "match",
+			method:      http.MethodGet,
+			ifNoneMatch: `"stale", ` + etag,
+			status:      http.StatusOK,
+			statusCode:  http.StatusNotModified,
+			etag:        true,
+		},
+		testCase{
+			name:        "non 2xx",
+			method:      http.MethodGet,
+			ifNoneMatch: etag,
+			status:      http.StatusNotFound,
+			statusCode:  http.StatusNotFound,
+			body:        body,
+		},
+		testCase{
+			name:        "streaming",
+			method:      http.MethodGet,
+			ifNoneMatch: etag,
+			status:      http.StatusOK,
+			stream:      true,
+			statusCode:  http.StatusOK,
+			body:        body,
+		},
+		testCase{
+			name:        "not a GET",
+			method:      http.MethodPost,
+			ifNoneMatch: etag,
+			status:      http.StatusOK,
+			statusCode:  http.StatusOK,
+			body:        body,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := withETag(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(c.status)
+				if c.stream {
+					w.(http.Flusher).Flush()
+				}
+				w.Write([]byte(body))
+			}))
+
+			r := httptest.NewRequest(c.method, "/", nil)
+			if c.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", c.ifNoneMatch)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.statusCode)
+			}
+			if got := rr.Header().Get("ETag"); (got == etag) != c.etag {
+				t.Errorf("expected etag to be set: %v; got: %q", c.etag, got)
+			}
+			if rr.Body.String() != c.body {
+				t.Errorf("expected bodies to match; got: %q, want: %q", rr.Body.String(), c.body)
+			}
+		})
+	}
+}
+
+func TestProxyETag(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message":"unit-test"}`))
+	}))
+	defer upstream.Close()
+
+	h := handler{
+		l:                log.NewNopLogger(),
+		optionProxyURL:   upstream.URL,
+		optionProxyETags: true,
+	}
+
+	first, _ := do(h, http.MethodGet, "/v1/proxy", http.Header{}, nil)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected a tagged response; got: %v with ETag %q", first.Code, etag)
+	}
+
+	second, _ := do(h, http.MethodGet, "/v1/proxy", http.Header{"If-None-Match": []string{etag}}, nil)
+	if second.Code != http.StatusNotModified {
+		t.Errorf("expected status codes to match; got: %v, want %v", second.Code, http.StatusNotModified)
+	}
+	if second.Body.Len() != 0 {
+		t.Errorf("expected no body; got: %q", second.Body.String())
+	}
+}
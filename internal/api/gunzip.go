@@ -0,0 +1,80 @@
+package api
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// withGunzip decompresses gzip encoded request bodies, so that next and the
+// upstream only ever see the plain body. The Content-Encoding header is
+// removed and the length becomes unknown, since it changes with the encoding.
+// A body without a valid gzip header is rejected with a 400. Corruption
+// further into the body is only found once it is read, as a gunzipError.
+// Likewise a body that decompresses to more than max bytes fails with a
+// bodyTooLargeError once the limit is read past, so that a small request
+// can't expand without bound.
+func withGunzip(next http.Handler, max int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := strings.TrimSpace(r.Header.Get("Content-Encoding"))
+		if !strings.EqualFold(encoding, "gzip") && !strings.EqualFold(encoding, "x-gzip") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			sendError(w, r, http.StatusBadRequest, "could not decompress gzip request body")
+			return
+		}
+
+		r.Body = limitBody(gunzipBody{Reader: zr, body: r.Body}, max)
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		r.ContentLength = -1
+		next.ServeHTTP(w, r)
+	})
+}
+
+// gunzipBody reads the decompressed body, closing the original body along
+// with the gzip reader.
+type gunzipBody struct {
+	*gzip.Reader
+	body io.Closer
+}
+
+func (b gunzipBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = gunzipError{err: err}
+	}
+	return n, err
+}
+
+func (b gunzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
+
+// gunzipError is returned when a gzip encoded request body turns out to be
+// corrupt while it is being read.
+type gunzipError struct {
+	err error
+}
+
+func (e gunzipError) Error() string {
+	return "could not decompress gzip request body: " + e.err.Error()
+}
+
+func (e gunzipError) Unwrap() error {
+	return e.err
+}
+
+// isGunzipError reports whether err came from a corrupt gzip request body,
+// which is the client's fault rather than ours or the upstream's.
+func isGunzipError(err error) bool {
+	var gzErr gunzipError
+	return errors.As(err, &gzErr)
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestWithGunzip(t *testing.T) {
+	type testCase struct {
+		name       string
+		encoding   string
+		body       []byte
+		max        int64
+		statusCode int
+		want       string
+	}
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(`{"unit":"test"}`))
+	zw.Close()
+
+	// The header is intact, but the compressed data and checksum are not
+	corrupt := append([]byte{}, compressed.Bytes()[:12]...)
+	corrupt = append(corrupt, []byte("not gzip")...)
+
+	cases := []testCase{
+		testCase{
+			name:       "gzip",
+			encoding:   "gzip",
+			body:       compressed.Bytes(),
+			statusCode: http.StatusOK,
+			want:       `{"unit":"test"}`,
+		},
+		testCase{
+			name:       "x-gzip",
+			encoding:   "X-Gzip",
+			body:       compressed.Bytes(),
+			statusCode: http.StatusOK,
+			want:       `{"unit":"test"}`,
+		},
+		testCase{
+			name:       "not encoded",
+			body:       []byte(`{"unit":"test"}`),
+			statusCode: http.StatusOK,
+			want:       `{"unit":"test"}`,
+		},
+		testCase{
+			name:       "not gzip",
+			encoding:   "gzip",
+			body:       []byte(`{"unit":"test"}`),
+			statusCode: http.StatusBadRequest,
+		},
+		testCase{
+			name:       "corrupt",
+			encoding:   "gzip",
+			body:       corrupt,
+			statusCode: http.StatusBadRequest,
+		},
+		testCase{
+			name:       "within limit",
+			encoding:   "gzip",
+			body:       compressed.Bytes(),
+			max:        int64(len(`{"unit":"test"}`)),
+			statusCode: http.StatusOK,
+			want:       `{"unit":"test"}`,
+		},
+		testCase{
+			name:       "too large",
+			encoding:   "gzip",
+			body:       compressed.Bytes(),
+			max:        int64(len(`{"unit":"test"}`)) - 1,
+			statusCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := withGunzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Content-Encoding"); got != "" && c.encoding != "" {
+					t.Errorf("expected content encoding to be removed; got: %q", got)
+				}
+
+				b, err := ioutil.ReadAll(r.Body)
+				if isGunzipError(err) {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				if isBodyTooLarge(err) {
+					w.WriteHeader(http.StatusRequestEntityTooLarge)
+					return
+				}
+				if string(b) != c.want {
+					t.Errorf("expected bodies to match; got: %q, want: %q", b, c.want)
+				}
+			}), c.max)
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/proxy", bytes.NewReader(c.body))
+			if c.encoding != "" {
+				r.Header.Set("Content-Encoding", c.encoding)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", w.Code, c.statusCode)
+			}
+		})
+	}
+}
+
+func TestProxyHandlerGunzip(t *testing.T) {
+	type testCase struct {
+		name       string
+		retries    int
+		corrupt    bool
+		max        int64
+		statusCode int
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "streamed",
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "buffered",
+			retries:    1,
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "streamed corrupt",
+			corrupt:    true,
+			statusCode: http.StatusBadRequest,
+		},
+		testCase{
+			name:       "buffered corrupt",
+			retries:    1,
+			corrupt:    true,
+			statusCode: http.StatusBadRequest,
+		},
+		testCase{
+			name:       "streamed too large",
+			max:        100,
+			statusCode: http.StatusRequestEntityTooLarge,
+		},
+		testCase{
+			name:       "buffered too large",
+			retries:    1,
+			max:        100,
+			statusCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(bytes.Repeat([]byte(`{"unit":"test"}`), 100))
+	zw.Close()
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var upstreamBody []byte
+			var upstreamEncoding string
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstreamEncoding = r.Header.Get("Content-Encoding")
+				upstreamBody, _ = ioutil.ReadAll(r.Body)
+			}))
+			defer upstream.Close()
+
+			h := handler{
+				l:                  log.NewNopLogger(),
+				optionProxyURL:     upstream.URL,
+				optionProxyRetries: c.retries,
+			}
+
+			body := compressed.Bytes()
+			if c.corrupt {
+				body = append(append([]byte{}, body[:20]...), bytes.Repeat([]byte{0xff}, 20)...)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/v1/proxy", bytes.NewReader(body))
+			r.Header.Set("Content-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			withGunzip(http.HandlerFunc(h.proxyHandler), c.max).ServeHTTP(w, r)
+
+			if w.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", w.Code, c.statusCode)
+			}
+			if c.corrupt || c.max > 0 {
+				return
+			}
+			if want := bytes.Repeat([]byte(`{"unit":"test"}`), 100); !bytes.Equal(upstreamBody, want) {
+				t.Errorf("expected the upstream to get the decompressed body; got: %q", upstreamBody)
+			}
+			if upstreamEncoding != "" {
+				t.Errorf("expected the upstream not to get a content encoding; got: %q", upstreamEncoding)
+			}
+		})
+	}
+}
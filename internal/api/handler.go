@@ -0,0 +1,187 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+type handler struct {
+	l              log.Logger
+	optionProxyURL string
+
+	// upstreams are the replicas of the upstream at optionProxyURL that the
+	// proxy requests are spread across when it is set.
+	upstreams *upstreamPool
+
+	// optionProxyTimeout and optionProbeTimeout are the budgets for the proxy
+	// and the probes, including any time spent queueing for the proxy.
+	optionProxyTimeout time.Duration
+	optionProbeTimeout time.Duration
+
+	// optionRequestBudget is the time budget every request is given, which
+	// handlers can check with Budget.
+	optionRequestBudget time.Duration
+
+	// optionProxyDryRun logs the requests that would be sent to the upstream
+	// and responds with a 200 instead of sending them.
+	optionProxyDryRun bool
+
+	// optionVersion is the deployed build reported on every response
+	optionVersion string
+
+	// verifier verifies the bearer tokens for the protected routes, which
+	// also require optionScope when it is set. The protected routes are open
+	// when there is no verifier.
+	verifier    Verifier
+	optionScope string
+
+	// optionAuthHeader and optionAuthScheme are where the bearer token is
+	// read from, defaulting to Authorization and Bearer.
+	optionAuthHeader string
+	optionAuthScheme string
+
+	// optionCertBoundTokens checks that tokens bound to a client certificate
+	// are presented with it.
+	optionCertBoundTokens bool
+
+	// authMetrics counts the decisions made for the protected routes
+	authMetrics *AuthMetrics
+
+	// ready holds the checks run by the readiness probe
+	ready *Readiness
+
+	// slowRequests keeps the slowest requests served
+	slowRequests *SlowRequests
+
+	// proxyClient makes the requests to the upstream, it is shared across
+	// requests so that connections are reused.
+	proxyClient *http.Client
+
+	// proxyMetrics tracks the requests made to the upstream
+	proxyMetrics *ProxyMetrics
+
+	// inFlightMetrics tracks the requests held to optionMaxInFlight
+	inFlightMetrics *InFlightMetrics
+
+	// requestTransform and responseTransform reshape the request to and the
+	// response from the upstream when they are set.
+	requestTransform  RequestTransform
+	responseTransform ResponseTransform
+
+	// optionCleanPathRedirect redirects GET requests for unclean paths to
+	// the canonical path instead of rewriting them.
+	optionCleanPathRedirect bool
+
+	// optionRejectUncleanPaths responds with a 400 to requests with
+	// duplicate slashes, . or .. segments or encoded slashes in their path,
+	// instead of cleaning them.
+	optionRejectUncleanPaths bool
+
+	// optionRequireHTTPS rejects protected requests that weren't made over
+	// https, trusting optionForwardedProtoHeader for the scheme when it is
+	// set.
+	optionRequireHTTPS         bool
+	optionForwardedProtoHeader string
+
+	// optionRequireJSONAccept responds with a 406 to requests that don't
+	// accept JSON.
+	optionRequireJSONAccept bool
+
+	// optionProxyAllowedMethods are the methods proxy requests can use when it
+	// is set. Any other method is a 405.
+	optionProxyAllowedMethods []string
+
+	// optionProxyAllowHeaders limits the incoming headers forwarded to the
+	// upstream when it is set. optionProxyDenyHeaders are never forwarded
+	// unless they are allowed, and default to defaultProxyDenyHeaders.
+	optionProxyAllowHeaders []string
+	optionProxyDenyHeaders  []string
+
+	// optionProxyRequiredFields are the fields a JSON body must have before it
+	// is forwarded to the upstream.
+	optionProxyRequiredFields []string
+
+	// optionProxyGunzipRequests decompresses gzip encoded bodies before they
+	// are validated and forwarded to the upstream.
+	optionProxyGunzipRequests bool
+
+	// optionProxyMaxBodyBytes is the largest request body that is read to be
+	// checked, decompressed or buffered for retries and signing. There is no
+	// limit when it is zero.
+	optionProxyMaxBodyBytes int64
+
+	// optionProxyRequireUTF8JSON strips byte order marks from JSON bodies and
+	// rejects the ones that aren't valid UTF-8.
+	optionProxyRequireUTF8JSON bool
+
+	// optionProxyRequiredHeaders are the headers that must be set on every
+	// proxy request, such as X-Tenant-ID.
+	optionProxyRequiredHeaders []string
+
+	// optionProxyRequestIDHeaders are the headers the trace ID is sent to the
+	// upstream in, such as X-Request-ID or X-Correlation-ID.
+	optionProxyRequestIDHeaders []string
+
+	// optionProxyRetries is the number of times a failed proxy request is
+	// retried. The body is buffered to be replayed, in memory up to
+	// optionProxyBufferBytes and in a temporary file past that.
+	optionProxyRetries     int
+	optionProxyBufferBytes int64
+
+	// optionProxySigningSecret signs the bodies sent to the upstream with
+	// HMAC-SHA256 when it is set. The signature and the timestamp it covers
+	// are sent in optionProxySignatureHeader and
+	// optionProxySignatureTimestampHeader.
+	optionProxySigningSecret            string
+	optionProxySignatureHeader          string
+	optionProxySignatureTimestampHeader string
+
+	// optionProxyMaxResponseBytes caps the size of the responses passed back
+	// from the upstream. It is unlimited when zero.
+	optionProxyMaxResponseBytes int64
+
+	// optionProxyCacheTTL is how long successful GET responses from the
+	// upstream are cached for. Nothing is cached when it is zero.
+	optionProxyCacheTTL time.Duration
+
+	// optionProxyCacheKeyHeaders are the headers cached responses are keyed
+	// by on top of the required headers.
+	optionProxyCacheKeyHeaders []string
+
+	// optionProxyETags answers GET requests with a 304 when the upstream's
+	// response hasn't changed since the client's copy.
+	optionProxyETags bool
+
+	// optionMaxInFlight caps the number of concurrent proxy requests, waiting
+	// up to optionMaxInFlightQueueTimeout for a slot before rejecting them. It
+	// is unlimited when zero.
+	optionMaxInFlight             int
+	optionMaxInFlightQueueTimeout time.Duration
+
+	// optionRateLimit is the number of requests per second each client can
+	// make to the proxy. Rate limiting is disabled when it is zero.
+	optionRateLimit      float64
+	optionRateLimitBurst int
+
+	// optionWriteKeys are the basic auth write keys allowed to use the proxy.
+	// Any request is allowed when there are none.
+	optionWriteKeys []string
+
+	// optionSigningSecret requires the bodies of incoming proxy requests to
+	// be signed with HMAC-SHA256, for partners that can't get a bearer
+	// token. The signature and timestamp are read from
+	// optionSignatureHeader and optionSignatureTimestampHeader, and the
+	// timestamp has to be within optionSignatureWindow when it is set.
+	optionSigningSecret            string
+	optionSignatureHeader          string
+	optionSignatureTimestampHeader string
+	optionSignatureWindow          time.Duration
+}
+
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	w.Write([]byte("Healthy AF"))
+	w.WriteHeader(http.StatusOK)
+}
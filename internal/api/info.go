@@ -0,0 +1,55 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+type infoResponse struct {
+	Build      string     `json:"build"`
+	GoVersion  string     `json:"goVersion"`
+	StartTime  string     `json:"startTime"`
+	Uptime     string     `json:"uptime"`
+	Goroutines int        `json:"goroutines"`
+	Memory     infoMemory `json:"memory"`
+}
+
+type infoMemory struct {
+	AllocBytes     uint64 `json:"allocBytes"`
+	HeapAllocBytes uint64 `json:"heapAllocBytes"`
+	SysBytes       uint64 `json:"sysBytes"`
+	NumGC          uint32 `json:"numGC"`
+}
+
+// InfoHandler responds with the build, the Go version, when the server
+// started and how long it has been up, along with some runtime stats, for a
+// quick look at a running instance. It must only be served on the internal
+// metrics server.
+func InfoHandler(build string, start time.Time) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+
+		resp := infoResponse{
+			Build:      build,
+			GoVersion:  runtime.Version(),
+			StartTime:  start.UTC().Format(time.RFC3339),
+			Uptime:     time.Since(start).Round(time.Second).String(),
+			Goroutines: runtime.NumGoroutine(),
+			Memory: infoMemory{
+				AllocBytes:     mem.Alloc,
+				HeapAllocBytes: mem.HeapAlloc,
+				SysBytes:       mem.Sys,
+				NumGC:          mem.NumGC,
+			},
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(resp)
+	})
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestInfoHandler(t *testing.T) {
+	start := time.Now().Add(-90 * time.Second)
+
+	rr := httptest.NewRecorder()
+	InfoHandler("unit-test", start).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/info", nil))
+
+	var resp infoResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if resp.Build != "unit-test" {
+		t.Errorf("expected builds to match; got: %q, want: %q", resp.Build, "unit-test")
+	}
+	if resp.GoVersion != runtime.Version() {
+		t.Errorf("expected go versions to match; got: %q, want: %q", resp.GoVersion, runtime.Version())
+	}
+	if uptime, err := time.ParseDuration(resp.Uptime); err != nil || uptime < 90*time.Second {
+		t.Errorf("expected a parseable uptime of at least 90s; got: %q", resp.Uptime)
+	}
+	if _, err := time.Parse(time.RFC3339, resp.StartTime); err != nil {
+		t.Errorf("expected a parseable start time; got: %q", resp.StartTime)
+	}
+	if resp.Goroutines < 1 || resp.Memory.SysBytes == 0 {
+		t.Errorf("expected runtime stats to be set; got: %+v", resp)
+	}
+}
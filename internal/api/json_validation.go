@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// jsonValidator validates a decoded JSON request body, returning every problem
+// it finds.
+type jsonValidator func(payload interface{}) []errorValidation
+
+// withJSONValidation decodes the JSON request body and checks it with validate,
+// responding with a 400 listing the validation errors if there are any. Bodies
+// over max bytes are turned away with a 413 before they are decoded.
+func withJSONValidation(next http.Handler, validate jsonValidator, max int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, ok := bufferBody(w, r, max)
+		if !ok {
+			return
+		}
+
+		var payload interface{}
+		if err := json.Unmarshal(b, &payload); err != nil {
+			sendValidationErrors(w, r, []errorValidation{
+				errorValidation{Field: "body", Reason: "must be valid JSON"},
+			})
+			return
+		}
+
+		if errs := validate(payload); len(errs) > 0 {
+			sendValidationErrors(w, r, errs)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireFields validates that the payload is a JSON object with a non-null
+// value for each of fields.
+func requireFields(fields ...string) jsonValidator {
+	return func(payload interface{}) []errorValidation {
+		obj, ok := payload.(map[string]interface{})
+		if !ok {
+			return []errorValidation{
+				errorValidation{Field: "body", Reason: "must be a JSON object"},
+			}
+		}
+
+		var errs []errorValidation
+		for _, field := range fields {
+			if obj[field] == nil {
+				errs = append(errs, errorValidation{Field: field, Reason: "is required"})
+			}
+		}
+		return errs
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithJSONValidation(t *testing.T) {
+	type testCase struct {
+		name       string
+		body       string
+		statusCode int
+		resp       apiError
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "valid",
+			body:       `{"email":"unit@test.com","event":"open"}`,
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "one missing field",
+			body:       `{"email":"unit@test.com"}`,
+			statusCode: http.StatusBadRequest,
+			resp: apiError{
+				Code:    "validation_failed",
+				Message: "request failed validation",
+				Errors: []errorValidation{
+					errorValidation{Field: "event", Reason: "is required"},
+				},
+			},
+		},
+		testCase{
+			name:       "multiple missing fields",
+			body:       `{"email":null}`,
+			statusCode: http.StatusBadRequest,
+			resp: apiError{
+				Code:    "validation_failed",
+				Message: "request failed validation",
+				Errors: []errorValidation{
+					errorValidation{Field: "email", Reason: "is required"},
+					errorValidation{Field: "event", Reason: "is required"},
+				},
+			},
+		},
+		testCase{
+			name:       "not an object",
+			body:       `["unit-test"]`,
+			statusCode: http.StatusBadRequest,
+			resp: apiError{
+				Code:    "validation_failed",
+				Message: "request failed validation",
+				Errors: []errorValidation{
+					errorValidation{Field: "body", Reason: "must be a JSON object"},
+				},
+			},
+		},
+		testCase{
+			name:       "malformed",
+			body:       `{"email":`,
+			statusCode: http.StatusBadRequest,
+			resp: apiError{
+				Code:    "validation_failed",
+				Message: "request failed validation",
+				Errors: []errorValidation{
+					errorValidation{Field: "body", Reason: "must be valid JSON"},
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var body string
+			h := withJSONValidation(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := ioutil.ReadAll(r.Body)
+				body = string(b)
+			}), requireFields("email", "event"), 0)
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/proxy", strings.NewReader(c.body)))
+
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.statusCode)
+			}
+
+			if c.statusCode == http.StatusOK {
+				if body != c.body {
+					t.Errorf("expected the body to still be readable; got: %q, want: %q", body, c.body)
+				}
+				return
+			}
+
+			var resp apiError
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err.Error())
+			}
+			if !reflect.DeepEqual(resp, c.resp) {
+				t.Errorf("expected responses to match; got: %v, want: %v", resp, c.resp)
+			}
+		})
+	}
+}
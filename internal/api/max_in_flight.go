@@ -0,0 +1,87 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// InFlightMetrics tracks how many requests are being served by the handlers
+// with a limit on them.
+type InFlightMetrics struct {
+	inFlight prometheus.Gauge
+}
+
+// NewInFlightMetrics creates the in flight metrics and registers them with
+// reg. If they have already been registered the existing collector is reused.
+func NewInFlightMetrics(reg prometheus.Registerer) (*InFlightMetrics, error) {
+	inFlight, err := register(reg, prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Count of HTTP requests currently being served by limited handlers",
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	return &InFlightMetrics{
+		inFlight: inFlight.(prometheus.Gauge),
+	}, nil
+}
+
+// add adds delta to the requests in flight. It does nothing when the metrics
+// haven't been set up.
+func (m *InFlightMetrics) add(delta float64) {
+	if m == nil {
+		return
+	}
+	m.inFlight.Add(delta)
+}
+
+// withMaxInFlight limits next to n concurrent requests. When every slot is
+// taken a request waits up to queueTimeout for one to free up, and is rejected
+// with a 503 if it doesn't. A zero queueTimeout rejects immediately. The
+// requests being served are counted in m.
+func withMaxInFlight(next http.Handler, n int, queueTimeout time.Duration, m *InFlightMetrics) http.Handler {
+	sem := make(chan struct{}, n)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !acquire(sem, r, queueTimeout) {
+			w.Header().Set("Retry-After", "1")
+			sendError(w, r, http.StatusServiceUnavailable, "too many requests in flight")
+			return
+		}
+		defer func() { <-sem }()
+
+		m.add(1)
+		defer m.add(-1)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acquire takes a slot from sem, waiting up to timeout for one if there are
+// none left.
+func acquire(sem chan struct{}, r *http.Request, timeout time.Duration) bool {
+	select {
+	case sem <- struct{}{}:
+		return true
+	default:
+	}
+
+	if timeout <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWithMaxInFlight(t *testing.T) {
+	type testCase struct {
+		name         string
+		queueTimeout time.Duration
+		statusCode   int
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "rejected immediately",
+			statusCode: http.StatusServiceUnavailable,
+		},
+		testCase{
+			name:         "rejected after queueing",
+			queueTimeout: 10 * time.Millisecond,
+			statusCode:   http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			started := make(chan struct{})
+			release := make(chan struct{})
+			h := withMaxInFlight(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/block" {
+					started <- struct{}{}
+					<-release
+				}
+			}), 2, c.queueTimeout, nil)
+
+			// Fill up every slot
+			var wg sync.WaitGroup
+			for i := 0; i < 2; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/block", nil))
+				}()
+				<-started
+			}
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", nil))
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match above the limit; got: %v, want %v", rr.Code, c.statusCode)
+			}
+			if rr.Header().Get("Retry-After") == "" {
+				t.Error("expected a Retry-After header above the limit")
+			}
+
+			close(release)
+			wg.Wait()
+
+			rr = httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", nil))
+			if rr.Code != http.StatusOK {
+				t.Errorf("expected status codes to match below the limit; got: %v, want %v", rr.Code, http.StatusOK)
+			}
+		})
+	}
+}
+
+func TestWithMaxInFlightQueue(t *testing.T) {
+	release := make(chan struct{})
+	h := withMaxInFlight(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/block" {
+			<-release
+		}
+	}), 1, time.Second, nil)
+
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/block", nil))
+		close(done)
+	}()
+
+	// Free the slot while the next request is queued
+	time.AfterFunc(10*time.Millisecond, func() { close(release) })
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", nil))
+	<-done
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected queued request to be served; got: %v, want %v", rr.Code, http.StatusOK)
+	}
+}
+
+func TestInFlightMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := NewInFlightMetrics(reg)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var inFlight float64
+	h := withMaxInFlight(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight = metricValue(t, reg, "http_requests_in_flight", nil)
+	}), 1, 0, m)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+
+	if inFlight != 1 {
+		t.Errorf("expected the request to be counted while served; got: %v, want: %v", inFlight, 1)
+	}
+	if got := metricValue(t, reg, "http_requests_in_flight", nil); got != 0 {
+		t.Errorf("expected no requests in flight once served; got: %v, want: %v", got, 0)
+	}
+}
+
+func TestNewInFlightMetricsRegisteredTwice(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	for i := 0; i < 2; i++ {
+		if _, err := NewInFlightMetrics(reg); err != nil {
+			t.Errorf("expected the metrics to be reused; got: %v", err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+
+	mw "github.com/RedVentures/make-mw/http"
+	"github.com/go-kit/kit/log"
+	newrelic "github.com/newrelic/go-agent"
+)
+
+// middleware wraps a handler with some behavior of its own.
+type middleware func(http.Handler) http.Handler
+
+// chain wraps h with every middleware in mws. The first middleware is the
+// outermost, so it is the first to see the request and the last to see the
+// response.
+func chain(h http.Handler, mws ...middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// skip wraps m so that it is bypassed for requests to any of paths, which are
+// matched exactly against the request's path, leaving out the query.
+func skip(m middleware, paths ...string) middleware {
+	skipped := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		skipped[p] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		wrapped := m(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if skipped[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			wrapped.ServeHTTP(w, r)
+		})
+	}
+}
+
+// logMiddleware captures l so that mw.WithLog can be used with chain.
+func logMiddleware(l log.Logger) middleware {
+	return func(next http.Handler) http.Handler {
+		return mw.WithLog(next, l)
+	}
+}
+
+// newRelicMiddleware captures app so that mw.WithNewRelic can be used with
+// chain.
+func newRelicMiddleware(app newrelic.Application) middleware {
+	return func(next http.Handler) http.Handler {
+		return mw.WithNewRelic(next, app)
+	}
+}
+
+// withLog is mw.WithLog for callers that don't go through chain. It is kept
+// for them alongside logMiddleware, which isn't in the router's chain.
+func withLog(next http.Handler, l log.Logger) http.Handler {
+	return logMiddleware(l)(next)
+}
+
+// withNewRelic is mw.WithNewRelic for callers that don't go through chain.
+func withNewRelic(next http.Handler, app newrelic.Application) http.Handler {
+	return newRelicMiddleware(app)(next)
+}
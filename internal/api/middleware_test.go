@@ -0,0 +1,128 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	mw "github.com/RedVentures/make-mw/http"
+	"github.com/go-kit/kit/log"
+	newrelic "github.com/newrelic/go-agent"
+	"github.com/rs/cors"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+	record := func(name string) middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name+" before")
+				next.ServeHTTP(w, r)
+				calls = append(calls, name+" after")
+			})
+		}
+	}
+
+	h := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+	}), record("first"), record("second"))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	want := []string{"first before", "second before", "handler", "second after", "first after"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("expected calls to match; got: %v, want: %v", calls, want)
+	}
+}
+
+func TestSkip(t *testing.T) {
+	type testCase struct {
+		name    string
+		url     string
+		skipped bool
+	}
+
+	cases := []testCase{
+		testCase{
+			name:    "listed path",
+			url:     "/health",
+			skipped: true,
+		},
+		testCase{
+			name:    "listed path with a query",
+			url:     "/ready?verbose=1",
+			skipped: true,
+		},
+		testCase{
+			name: "other path",
+			url:  "/v1/proxy",
+		},
+		testCase{
+			name: "listed path prefix",
+			url:  "/health/deep",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ran := false
+			m := func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					ran = true
+					next.ServeHTTP(w, r)
+				})
+			}
+
+			served := false
+			h := skip(m, "/health", "/ready")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				served = true
+			}))
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, c.url, nil))
+
+			if !served {
+				t.Error("expected the handler to be served")
+			}
+			if ran == c.skipped {
+				t.Errorf("expected the middleware to be skipped only for the listed paths; ran: %v", ran)
+			}
+		})
+	}
+}
+
+func TestMiddlewareSignatures(t *testing.T) {
+	nr, err := newrelic.NewApplication(newrelic.NewConfig("unit-test", "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	mws := map[string]middleware{
+		"prometheus":    mw.WithPrometheus,
+		"request id":    mw.WithRequestID,
+		"log":           logMiddleware(log.NewNopLogger()),
+		"new relic":     newRelicMiddleware(nr),
+		"trace context": withTraceContext,
+		"cors":          cors.AllowAll().Handler,
+		"with log": func(next http.Handler) http.Handler {
+			return withLog(next, log.NewNopLogger())
+		},
+		"with new relic": func(next http.Handler) http.Handler {
+			return withNewRelic(next, nr)
+		},
+	}
+
+	for name, m := range mws {
+		t.Run(name, func(t *testing.T) {
+			h := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			}), m)
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rr.Code != http.StatusTeapot {
+				t.Errorf("expected the wrapped handler to be called; got: %v, want: %v", rr.Code, http.StatusTeapot)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	rvAuth "github.com/RedVentures/sdk-go/auth"
+)
+
+// MultiVerifier is a Verifier for tokens from several tenants, such as partners
+// that each send webhooks with tokens from a tenant of their own. Every token
+// is passed to the verifier of the tenant that issued it, which is read from
+// the token before it is verified. That only picks the verifier, which still
+// checks the issuer along with everything else. Tokens from any other issuer
+// are rejected.
+type MultiVerifier struct {
+	verifiers map[string]Verifier
+}
+
+// NewMultiVerifier creates a verifier routing tokens to the verifiers given for
+// each tenant URL, such as https://example.auth0.com.
+func NewMultiVerifier(verifiers map[string]Verifier) *MultiVerifier {
+	m := &MultiVerifier{
+		verifiers: make(map[string]Verifier, len(verifiers)),
+	}
+	for tenantURL, v := range verifiers {
+		m.verifiers[issuerKey(tenantURL)] = v
+	}
+	return m
+}
+
+// VerifyToken has raw verified by the verifier for its issuer.
+func (m *MultiVerifier) VerifyToken(raw string) (*rvAuth.Token, error) {
+	issuer := unverifiedClaims(raw).Issuer
+	v, ok := m.verifiers[issuerKey(issuer)]
+	if !ok || issuer == "" {
+		return nil, fmt.Errorf("bad token: issuer '%s' is not a known tenant", issuer)
+	}
+	return v.VerifyToken(raw)
+}
+
+// ResetCache resets the caches of every verifier that has one.
+func (m *MultiVerifier) ResetCache() {
+	for _, v := range m.verifiers {
+		if r, ok := v.(CacheResetter); ok {
+			r.ResetCache()
+		}
+	}
+}
+
+// issuerKey is the issuer of tokens from a tenant URL, which Auth0 ends with a
+// single slash.
+func issuerKey(tenantURL string) string {
+	return strings.TrimRight(tenantURL, "/") + "/"
+}
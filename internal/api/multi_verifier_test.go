@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+// issuedToken returns an unsigned JWT from issuer, which is only good for
+// routing.
+func issuedToken(issuer string) string {
+	return "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"`+issuer+`"}`)) + ".c2lnbmF0dXJl"
+}
+
+func TestMultiVerifier(t *testing.T) {
+	type testCase struct {
+		name    string
+		token   string
+		subject string
+		wantErr bool
+	}
+
+	partnerA := issuedToken("https://partner-a.auth0.com/")
+	partnerB := issuedToken("https://partner-b.auth0.com/")
+	forged := issuedToken("https://partner-b.auth0.com/") + "-forged"
+
+	cases := []testCase{
+		testCase{
+			name:    "first tenant",
+			token:   partnerA,
+			subject: "partner-a",
+		},
+		testCase{
+			name:    "second tenant",
+			token:   partnerB,
+			subject: "partner-b",
+		},
+		testCase{
+			name:    "rejected by the tenant's verifier",
+			token:   forged,
+			wantErr: true,
+		},
+		testCase{
+			name:    "unknown issuer",
+			token:   issuedToken("https://unknown.auth0.com/"),
+			wantErr: true,
+		},
+		testCase{
+			name:    "no issuer",
+			token:   "unit-test",
+			wantErr: true,
+		},
+	}
+
+	v := NewMultiVerifier(map[string]Verifier{
+		"https://partner-a.auth0.com":  fakeVerifier{partnerA: newTestToken(partnerA, "partner-a", "")},
+		"https://partner-b.auth0.com/": fakeVerifier{partnerB: newTestToken(partnerB, "partner-b", "")},
+	})
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			token, err := v.VerifyToken(c.token)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("expected error to match; got: %v, want error: %v", err, c.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if token.Claims.Subject != c.subject {
+				t.Errorf("expected subjects to match; got: %q, want: %q", token.Claims.Subject, c.subject)
+			}
+		})
+	}
+}
+
+// resettableVerifier records whether its cache was reset.
+type resettableVerifier struct {
+	fakeVerifier
+	reset bool
+}
+
+func (v *resettableVerifier) ResetCache() {
+	v.reset = true
+}
+
+func TestMultiVerifierResetCache(t *testing.T) {
+	a, b := &resettableVerifier{}, &resettableVerifier{}
+	NewMultiVerifier(map[string]Verifier{
+		"https://partner-a.auth0.com": a,
+		"https://partner-b.auth0.com": b,
+		"https://partner-c.auth0.com": fakeVerifier{},
+	}).ResetCache()
+
+	if !a.reset || !b.reset {
+		t.Errorf("expected every cache to be reset; got: %v, %v", a.reset, b.reset)
+	}
+}
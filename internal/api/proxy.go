@@ -0,0 +1,431 @@
+package api
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// defaultProxyClient is used when the handler doesn't have a proxy client.
+var defaultProxyClient = NewProxyClient(100, 90*time.Second, 30*time.Second, nil, nil)
+
+// NewProxyClient creates the client used to make requests to the upstream. It
+// should be created once and shared so that connections to the upstream are
+// reused instead of doing a new TCP and TLS handshake for every request.
+//
+// Redirects are only followed to redirectHosts, any other redirect is passed
+// back to the client as is. tlsConfig is used for HTTPS upstreams, the system
+// defaults are used when it is nil.
+//
+// The client has no overall timeout, since that would cap the proxy route's
+// own timeout and cut off event streams. Requests are bounded by their context
+// instead, and by responseHeaderTimeout for the upstream to start responding,
+// which also holds for event streams.
+func NewProxyClient(maxIdleConnsPerHost int, idleConnTimeout, responseHeaderTimeout time.Duration, redirectHosts []string, tlsConfig *tls.Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 0
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	transport.IdleConnTimeout = idleConnTimeout
+	transport.ResponseHeaderTimeout = responseHeaderTimeout
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &http.Client{
+		Transport:     transport,
+		CheckRedirect: redirectPolicy(redirectHosts),
+	}
+}
+
+// redirectPolicy only follows redirects to one of hosts, which can either be a
+// hostname or a host and port. A webhook relay shouldn't silently end up
+// somewhere we didn't intend to send it.
+func redirectPolicy(hosts []string) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+
+		for _, host := range hosts {
+			if strings.EqualFold(req.URL.Host, host) || strings.EqualFold(req.URL.Hostname(), host) {
+				return nil
+			}
+		}
+
+		return http.ErrUseLastResponse
+	}
+}
+
+func (h *handler) proxyHandler(w http.ResponseWriter, r *http.Request) {
+	l := h.l
+	if tc, ok := traceContextFromContext(r.Context()); ok {
+		l = log.With(l, "traceId", tc.TraceID)
+	}
+	if version, ok := versionFromContext(r.Context()); ok {
+		l = log.With(l, "version", version)
+	}
+	if fields := tokenLogFields(r.Context()); len(fields) > 0 {
+		l = log.With(l, fields...)
+	}
+
+	l.Log("level", "info", "msg", "received proxy request")
+
+	proxyURL, err := url.Parse(h.optionProxyURL)
+	if err != nil {
+		l.Log("level", "error", "msg", "could not parse proxy url", "err", err.Error())
+		sendError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	proxyReq, err := h.newProxyRequest(r, proxyURL.String(), r.Body)
+	if err != nil {
+		l.Log("level", "error", "msg", "could not create new http request", "err", err.Error())
+		sendError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if h.requestTransform != nil {
+		if err := h.requestTransform(proxyReq); err != nil {
+			l.Log("level", "error", "msg", "could not transform proxy request", "err", err.Error())
+			sendError(w, r, http.StatusInternalServerError, "could not transform proxy request: "+err.Error())
+			return
+		}
+	}
+
+	// The body can only be read once, so when retries are enabled it is
+	// buffered so that it can be sent with every attempt. Signing reads the
+	// whole body before it is sent, so it has to be buffered for that too.
+	var buf *replayBuffer
+	if h.optionProxyRetries > 0 || h.optionProxySigningSecret != "" {
+		buf, err = newReplayBuffer(proxyReq.Body, h.optionProxyBufferBytes, h.optionProxyMaxBodyBytes)
+		if err != nil {
+			l.Log("level", "error", "msg", "could not buffer request body", "err", err.Error())
+			if isGunzipError(err) {
+				sendError(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+			if isBodyTooLarge(err) {
+				sendError(w, r, http.StatusRequestEntityTooLarge, err.Error())
+				return
+			}
+			sendError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		defer buf.Close()
+	}
+
+	if h.optionProxySigningSecret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		signature, err := signBody(h.optionProxySigningSecret, timestamp, buf.Reader())
+		if err != nil {
+			l.Log("level", "error", "msg", "could not sign request body", "err", err.Error())
+			sendError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		proxyReq.Header.Set(h.signatureHeader(), signature)
+		proxyReq.Header.Set(h.signatureTimestampHeader(), timestamp)
+	}
+
+	if h.optionProxyDryRun {
+		dryRun(w, proxyReq, buf, l)
+		return
+	}
+
+	// Use the default client if one isn't provided
+	client := h.proxyClient
+	if client == nil {
+		client = defaultProxyClient
+	}
+
+	var proxyResp *http.Response
+	for attempt := 0; ; attempt++ {
+		attemptReq := proxyReq
+		if buf != nil {
+			attemptReq = proxyReq.Clone(r.Context())
+			attemptReq.Body, _ = replayBody(buf)
+			attemptReq.GetBody = func() (io.ReadCloser, error) { return replayBody(buf) }
+			attemptReq.ContentLength = buf.Size()
+		}
+
+		// Every attempt can go to a different replica, keeping the path
+		var upstream *url.URL
+		if h.upstreams != nil {
+			upstream = h.upstreams.next()
+			attemptReq.URL.Scheme = upstream.Scheme
+			attemptReq.URL.Host = upstream.Host
+			attemptReq.Host = upstream.Host
+		}
+
+		start := time.Now()
+		proxyResp, err = client.Do(attemptReq)
+		h.proxyMetrics.observe(r.Context(), attemptReq.URL.Host, proxyResp, err, time.Since(start))
+		if upstream != nil && r.Context().Err() == nil {
+			h.upstreams.report(upstream, err == nil && proxyResp.StatusCode < http.StatusInternalServerError)
+		}
+		retry := attempt < h.optionProxyRetries && r.Context().Err() == nil && shouldRetry(proxyResp, err)
+
+		// Another attempt that won't finish in the time left only delays the
+		// error
+		if remaining, ok := Budget(r.Context()); retry && ok && remaining < time.Since(start) {
+			l.Log("level", "info", "msg", "not retrying proxy request, too little budget left", "remaining", remaining.String())
+			retry = false
+		}
+		if retry {
+			if err == nil {
+				proxyResp.Body.Close()
+			}
+			l.Log("level", "info", "msg", "retrying proxy request", "attempt", attempt+1)
+			continue
+		}
+
+		if err != nil {
+			l.Log("level", "error", "msg", "could do proxy request", "err", err.Error())
+			if isGunzipError(err) {
+				sendError(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+			if isBodyTooLarge(err) {
+				sendError(w, r, http.StatusRequestEntityTooLarge, err.Error())
+				return
+			}
+			sendUpstreamError(w, r, err)
+			return
+		}
+		break
+	}
+	defer proxyResp.Body.Close()
+
+	if h.responseTransform != nil {
+		if err := h.responseTransform(proxyResp); err != nil {
+			l.Log("level", "error", "msg", "could not transform proxy response", "err", err.Error())
+			sendError(w, r, http.StatusInternalServerError, "could not transform proxy response: "+err.Error())
+			return
+		}
+	}
+
+	// Redirects that weren't followed are passed back to the client untouched
+	if proxyResp.StatusCode < 200 || proxyResp.StatusCode >= 400 {
+		l.Log("level", "info", "msg", "bad status code from proxy response", "status", proxyResp.StatusCode)
+		sendError(w, r, proxyResp.StatusCode, fmt.Sprintf("bad status from proxy request got: %d", proxyResp.StatusCode))
+		return
+	}
+
+	// Cap how much the upstream can send back through us. A response that is
+	// known to be too big is refused before anything is sent, anything else is
+	// cut off at the cap. Event streams are long lived by design, so they are
+	// left alone.
+	var body io.Reader = proxyResp.Body
+	var limited *limitedBody
+	if max := h.optionProxyMaxResponseBytes; max > 0 && !isEventStream(r.Header.Get("Accept")) && !isEventStream(proxyResp.Header.Get("Content-Type")) {
+		if proxyResp.ContentLength > max {
+			l.Log("level", "warn", "msg", "proxy response is too large", "bytes", proxyResp.ContentLength, "max", max)
+			sendError(w, r, http.StatusBadGateway, "upstream response is too large")
+			return
+		}
+		limited = newLimitedBody(proxyResp.Body, max)
+		body = limited
+	}
+
+	// Copy the upstream headers onto our response, announcing any trailers the
+	// upstream will send after the body so that we can pass them on as well.
+	copyHeader(w.Header(), proxyResp.Header)
+	for trailer := range proxyResp.Trailer {
+		w.Header().Add("Trailer", trailer)
+	}
+
+	// Event streams stay open until either side closes them, so they are let
+	// off the route's timeout, and nothing between us and the client may hold
+	// on to events
+	eventStream := isEventStream(r.Header.Get("Accept")) || isEventStream(proxyResp.Header.Get("Content-Type"))
+	if eventStream {
+		liftTimeout(r.Context())
+		w.Header().Del("Content-Length")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+	}
+
+	w.WriteHeader(proxyResp.StatusCode)
+
+	// Event streams and chunked responses of unknown length are streamed to
+	// the client as they arrive, everything else is left to the server to
+	// buffer so that it can be cached
+	if err := copyResponse(w, body, eventStream || proxyResp.ContentLength < 0); err != nil {
+		l.Log("level", "error", "msg", "could not copy proxy response body", "err", err.Error())
+		return
+	}
+	if limited != nil && limited.exceeded {
+		l.Log("level", "warn", "msg", "truncated proxy response", "max", h.optionProxyMaxResponseBytes)
+	}
+
+	// The trailer values are only populated once the body has been read
+	for trailer, values := range proxyResp.Trailer {
+		for _, v := range values {
+			w.Header().Add(trailer, v)
+		}
+	}
+}
+
+// newProxyRequest creates the request to the upstream for r with the given
+// body.
+func (h *handler) newProxyRequest(r *http.Request, target string, body io.Reader) (*http.Request, error) {
+	// Use the incoming request's context so that the upstream request is
+	// cancelled when the client goes away or the request times out
+	proxyReq, err := http.NewRequestWithContext(r.Context(), r.Method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	proxyReq.Header.Set("Host", r.Host)
+	proxyReq.Header.Set("X-Forwarded-For", r.RemoteAddr)
+
+	// Loop through our request headers and set the ones we are allowed to
+	// forward on the proxy request
+	for header, values := range r.Header {
+		if !h.forwardHeader(header) {
+			continue
+		}
+		for _, v := range values {
+			proxyReq.Header.Add(header, v)
+		}
+	}
+
+	// Continue the trace on the upstream with our span as the parent
+	if tc, ok := traceContextFromContext(r.Context()); ok {
+		proxyReq.Header.Set("traceparent", tc.traceparent())
+		if tc.State != "" {
+			proxyReq.Header.Set("tracestate", tc.State)
+		}
+
+		// Upstreams that don't understand trace context still get the trace
+		// ID as their correlation ID
+		for _, header := range h.optionProxyRequestIDHeaders {
+			proxyReq.Header.Set(header, tc.TraceID)
+		}
+	}
+
+	return proxyReq, nil
+}
+
+// replayBody returns a new body reading from the start of buf. An empty body is
+// http.NoBody, as it would be from http.NewRequest, so that it isn't sent as a
+// chunked body of unknown length.
+func replayBody(buf *replayBuffer) (io.ReadCloser, error) {
+	if buf.Size() == 0 {
+		return http.NoBody, nil
+	}
+	return ioutil.NopCloser(buf.Reader()), nil
+}
+
+// shouldRetry reports whether a proxy request is worth trying again, which is
+// when the upstream couldn't be reached or it is temporarily unavailable.
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// defaultProxyDenyHeaders are the headers that are never forwarded to the
+// upstream unless they are explicitly allowed, since they carry credentials
+// meant for us and not a third party.
+var defaultProxyDenyHeaders = []string{"Authorization", "Cookie"}
+
+// forwardHeader reports whether the incoming header should be sent to the
+// upstream. When an allow list is configured only those headers are forwarded,
+// otherwise everything but the deny list is. A custom auth header is always
+// denied along with the list, since it carries the same credentials as
+// Authorization would.
+func (h *handler) forwardHeader(header string) bool {
+	if containsHeader(h.optionProxyAllowHeaders, header) {
+		return true
+	}
+
+	deny := h.optionProxyDenyHeaders
+	if deny == nil {
+		deny = defaultProxyDenyHeaders
+	}
+	if containsHeader(deny, header) || (h.optionAuthHeader != "" && strings.EqualFold(h.optionAuthHeader, header)) {
+		return false
+	}
+
+	return len(h.optionProxyAllowHeaders) == 0
+}
+
+func containsHeader(headers []string, header string) bool {
+	for _, h := range headers {
+		if strings.EqualFold(h, header) {
+			return true
+		}
+	}
+	return false
+}
+
+// isEventStream reports whether an Accept or Content-Type header value is for
+// server-sent events.
+func isEventStream(value string) bool {
+	for _, v := range strings.Split(value, ",") {
+		mediaType, _, err := mime.ParseMediaType(v)
+		if err == nil && mediaType == "text/event-stream" {
+			return true
+		}
+	}
+	return false
+}
+
+// copyResponse writes body to w. When stream is set it flushes after every
+// write, so that the response reaches the client as it arrives instead of
+// being buffered.
+func copyResponse(w http.ResponseWriter, body io.Reader, stream bool) error {
+	var flusher http.Flusher
+	if stream {
+		flusher, _ = w.(http.Flusher)
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// signatureHeader is the header the body signature is sent in.
+func (h *handler) signatureHeader() string {
+	if h.optionProxySignatureHeader == "" {
+		return defaultSignatureHeader
+	}
+	return h.optionProxySignatureHeader
+}
+
+// signatureTimestampHeader is the header the signed timestamp is sent in.
+func (h *handler) signatureTimestampHeader() string {
+	if h.optionProxySignatureTimestampHeader == "" {
+		return defaultSignatureTimestampHeader
+	}
+	return h.optionProxySignatureTimestampHeader
+}
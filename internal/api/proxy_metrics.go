@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ProxyMetrics track the health of the upstream separately from the metrics for
+// our own endpoints.
+type ProxyMetrics struct {
+	requests *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+}
+
+// NewProxyMetrics creates the upstream metrics and registers them with reg. If
+// they have already been registered the existing collectors are reused, so that
+// this can be called more than once without panicking.
+func NewProxyMetrics(reg prometheus.Registerer) (*ProxyMetrics, error) {
+	requests, err := register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_upstream_requests_total",
+		Help: "Count of all requests made to the proxy upstream",
+	}, []string{"host", "status"}))
+	if err != nil {
+		return nil, err
+	}
+
+	latency, err := register(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "proxy_upstream_request_duration_milliseconds",
+		Help:    "Latency of requests made to the proxy upstream",
+		Buckets: []float64{1, 10, 50, 100, 200, 300, 500, 600, 700, 800, 900, 1000, 2500, 5000},
+	}, []string{"host", "status"}))
+	if err != nil {
+		return nil, err
+	}
+
+	errs, err := register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_upstream_errors_total",
+		Help: "Count of requests to the proxy upstream that failed without a response",
+	}, []string{"host", "reason"}))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProxyMetrics{
+		requests: requests.(*prometheus.CounterVec),
+		latency:  latency.(*prometheus.HistogramVec),
+		errors:   errs.(*prometheus.CounterVec),
+	}, nil
+}
+
+// register registers c with reg, returning the collector that was already
+// registered in its place if there is one.
+func register(reg prometheus.Registerer, c prometheus.Collector) (prometheus.Collector, error) {
+	if err := reg.Register(c); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			return nil, err
+		}
+		return are.ExistingCollector, nil
+	}
+	return c, nil
+}
+
+// observe records a single request to the upstream host. Its latency carries
+// the trace and span IDs from ctx as an exemplar when there are any, so that a
+// slow bucket leads to a trace. It does nothing when the metrics haven't been
+// set up.
+func (m *ProxyMetrics) observe(ctx context.Context, host string, resp *http.Response, err error, dur time.Duration) {
+	if m == nil {
+		return
+	}
+
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	} else {
+		m.errors.WithLabelValues(host, errorReason(err)).Inc()
+	}
+
+	m.requests.WithLabelValues(host, status).Inc()
+	latency := m.latency.WithLabelValues(host, status)
+	ms := float64(dur.Nanoseconds()) / float64(time.Millisecond)
+	if tc, ok := traceContextFromContext(ctx); ok {
+		if e, ok := latency.(prometheus.ExemplarObserver); ok {
+			e.ObserveWithExemplar(ms, prometheus.Labels{"trace_id": tc.TraceID, "span_id": tc.SpanID})
+			return
+		}
+	}
+	latency.Observe(ms)
+}
+
+// errorReason classifies an error from the proxy client.
+func errorReason(err error) string {
+	if errors.Is(err, context.Canceled) {
+		return "canceled"
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return "timeout"
+	}
+
+	return "connection"
+}
@@ -0,0 +1,222 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricValue returns the value of a counter, or the sample count of a
+// histogram, with the given labels.
+func metricValue(t *testing.T, reg *prometheus.Registry, name string, labels map[string]string) float64 {
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+	metrics:
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if labels[label.GetName()] != label.GetValue() {
+					continue metrics
+				}
+			}
+			if m.GetHistogram() != nil {
+				return float64(m.GetHistogram().GetSampleCount())
+			}
+			if m.GetGauge() != nil {
+				return m.GetGauge().GetValue()
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestProxyMetrics(t *testing.T) {
+	type testCase struct {
+		name     string
+		upstream http.HandlerFunc
+		closed   bool
+		timeout  time.Duration
+		status   string
+		reason   string
+	}
+
+	cases := []testCase{
+		testCase{
+			name:     "success",
+			upstream: func(w http.ResponseWriter, r *http.Request) {},
+			status:   "200",
+		},
+		testCase{
+			name: "failure",
+			upstream: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			status: "500",
+		},
+		testCase{
+			name: "timeout",
+			upstream: func(w http.ResponseWriter, r *http.Request) {
+				// Block until the client gives up
+				<-r.Context().Done()
+			},
+			timeout: 10 * time.Millisecond,
+			status:  "error",
+			reason:  "timeout",
+		},
+		testCase{
+			name:     "connection error",
+			upstream: func(w http.ResponseWriter, r *http.Request) {},
+			closed:   true,
+			status:   "error",
+			reason:   "connection",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			upstream := httptest.NewServer(c.upstream)
+			defer upstream.Close()
+			if c.closed {
+				upstream.Close()
+			}
+			u, _ := url.Parse(upstream.URL)
+
+			reg := prometheus.NewRegistry()
+			m, err := NewProxyMetrics(reg)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			// Only the timeout case can afford a client that gives up quickly
+			client := http.DefaultClient
+			if c.timeout > 0 {
+				client = &http.Client{Timeout: c.timeout}
+			}
+
+			h := handler{
+				l:              log.NewNopLogger(),
+				optionProxyURL: upstream.URL,
+				proxyClient:    client,
+				proxyMetrics:   m,
+			}
+			h.proxyHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/proxy", nil))
+
+			labels := map[string]string{"host": u.Host, "status": c.status}
+			if got := metricValue(t, reg, "proxy_upstream_requests_total", labels); got != 1 {
+				t.Errorf("expected request count to move; got: %v, want: %v", got, 1)
+			}
+			if got := metricValue(t, reg, "proxy_upstream_request_duration_milliseconds", labels); got != 1 {
+				t.Errorf("expected latency to be observed; got: %v, want: %v", got, 1)
+			}
+
+			var want float64
+			if c.reason != "" {
+				want = 1
+			}
+			labels = map[string]string{"host": u.Host, "reason": c.reason}
+			if got := metricValue(t, reg, "proxy_upstream_errors_total", labels); got != want {
+				t.Errorf("expected error count to match; got: %v, want: %v", got, want)
+			}
+		})
+	}
+}
+
+func TestProxyMetricsExemplar(t *testing.T) {
+	type testCase struct {
+		name     string
+		traced   bool
+		exemplar bool
+	}
+
+	cases := []testCase{
+		testCase{
+			name:     "traced",
+			traced:   true,
+			exemplar: true,
+		},
+		testCase{
+			name: "not traced",
+		},
+	}
+
+	tc := traceContext{
+		TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:  "00f067aa0ba902b7",
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			m, err := NewProxyMetrics(reg)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			ctx := context.Background()
+			if c.traced {
+				ctx = context.WithValue(ctx, contextKeyTraceContext, tc)
+			}
+			m.observe(ctx, "upstream", &http.Response{StatusCode: http.StatusOK}, nil, 20*time.Millisecond)
+
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			exemplars := map[string]string{}
+			for _, family := range families {
+				if family.GetName() != "proxy_upstream_request_duration_milliseconds" {
+					continue
+				}
+				for _, metric := range family.GetMetric() {
+					for _, b := range metric.GetHistogram().GetBucket() {
+						for _, label := range b.GetExemplar().GetLabel() {
+							exemplars[label.GetName()] = label.GetValue()
+						}
+					}
+				}
+			}
+
+			if !c.exemplar {
+				if len(exemplars) > 0 {
+					t.Errorf("expected no exemplar; got: %v", exemplars)
+				}
+				return
+			}
+			if exemplars["trace_id"] != tc.TraceID || exemplars["span_id"] != tc.SpanID {
+				t.Errorf("expected an exemplar with the trace and span IDs; got: %v", exemplars)
+			}
+		})
+	}
+}
+
+func TestNewProxyMetricsRegisteredTwice(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	first, err := NewProxyMetrics(reg)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	second, err := NewProxyMetrics(reg)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if first.requests != second.requests {
+		t.Error("expected the existing collectors to be reused")
+	}
+}
@@ -0,0 +1,431 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestProxyHandlerTrailers(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+
+		// Flushing between writes forces a chunked response
+		w.Write([]byte("hello "))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("world"))
+
+		w.Header().Set("X-Checksum", "unit-test")
+	}))
+	defer upstream.Close()
+
+	h := handler{
+		l:              log.NewNopLogger(),
+		optionProxyURL: upstream.URL,
+	}
+	proxy := httptest.NewServer(http.HandlerFunc(h.proxyHandler))
+	defer proxy.Close()
+
+	resp, err := http.Post(proxy.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if string(body) != "hello world" {
+		t.Errorf("expected bodies to match; got: %q, want: %q", body, "hello world")
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/plain" {
+		t.Errorf("expected content types to match; got: %q, want: %q", got, "text/plain")
+	}
+	if got := resp.Trailer.Get("X-Checksum"); got != "unit-test" {
+		t.Errorf("expected trailers to match; got: %q, want: %q", got, "unit-test")
+	}
+}
+
+func TestProxyHandlerHeaders(t *testing.T) {
+	type testCase struct {
+		name       string
+		allow      []string
+		deny       []string
+		authHeader string
+		forwarded  []string
+		stripped   []string
+	}
+
+	cases := []testCase{
+		testCase{
+			name:      "default deny list",
+			forwarded: []string{"Content-Type", "X-Custom"},
+			stripped:  []string{"Authorization", "Cookie"},
+		},
+		testCase{
+			name:      "allow list",
+			allow:     []string{"content-type"},
+			forwarded: []string{"Content-Type"},
+			stripped:  []string{"Authorization", "Cookie", "X-Custom"},
+		},
+		testCase{
+			name:      "explicitly allowed credentials",
+			allow:     []string{"Authorization", "Content-Type", "X-Custom"},
+			forwarded: []string{"Authorization", "Content-Type", "X-Custom"},
+			stripped:  []string{"Cookie"},
+		},
+		testCase{
+			name:      "custom deny list",
+			deny:      []string{"X-Custom"},
+			forwarded: []string{"Authorization", "Content-Type", "Cookie"},
+			stripped:  []string{"X-Custom"},
+		},
+		testCase{
+			name:       "custom auth header",
+			deny:       []string{"Cookie"},
+			authHeader: "x-custom",
+			forwarded:  []string{"Authorization", "Content-Type"},
+			stripped:   []string{"Cookie", "X-Custom"},
+		},
+		testCase{
+			name:       "explicitly allowed custom auth header",
+			allow:      []string{"X-Custom"},
+			authHeader: "X-Custom",
+			forwarded:  []string{"X-Custom"},
+			stripped:   []string{"Authorization", "Content-Type", "Cookie"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var upstreamHeader http.Header
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstreamHeader = r.Header
+			}))
+			defer upstream.Close()
+
+			h := handler{
+				l:                       log.NewNopLogger(),
+				optionProxyURL:          upstream.URL,
+				optionProxyAllowHeaders: c.allow,
+				optionProxyDenyHeaders:  c.deny,
+				optionAuthHeader:        c.authHeader,
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/proxy", nil)
+			r.Header.Set("Authorization", "Bearer unit-test")
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("Cookie", "session=unit-test")
+			r.Header.Set("X-Custom", "unit-test")
+			h.proxyHandler(httptest.NewRecorder(), r)
+
+			for _, header := range c.forwarded {
+				if upstreamHeader.Get(header) == "" {
+					t.Errorf("expected %s to be forwarded", header)
+				}
+			}
+			for _, header := range c.stripped {
+				if upstreamHeader.Get(header) != "" {
+					t.Errorf("expected %s to be stripped; got: %v", header, upstreamHeader.Get(header))
+				}
+			}
+		})
+	}
+}
+
+func TestProxyHandlerRetries(t *testing.T) {
+	type testCase struct {
+		name       string
+		retries    int
+		body       string
+		bufferSize int64
+		maxBody    int64
+		budget     time.Duration
+		statusCode int
+		attempts   int
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "no retries",
+			body:       "unit-test",
+			statusCode: http.StatusServiceUnavailable,
+			attempts:   1,
+		},
+		testCase{
+			name:       "small body replayed",
+			retries:    2,
+			body:       "unit-test",
+			bufferSize: 1024,
+			statusCode: http.StatusOK,
+			attempts:   2,
+		},
+		testCase{
+			name:       "large body replayed",
+			retries:    2,
+			body:       strings.Repeat("unit-test", 1024),
+			bufferSize: 16,
+			statusCode: http.StatusOK,
+			attempts:   2,
+		},
+		testCase{
+			name:       "large body over the limit",
+			retries:    2,
+			body:       strings.Repeat("unit-test", 1024),
+			bufferSize: 16,
+			maxBody:    1024,
+			statusCode: http.StatusRequestEntityTooLarge,
+		},
+		testCase{
+			name:       "budget spent",
+			retries:    2,
+			body:       "unit-test",
+			bufferSize: 1024,
+			budget:     time.Nanosecond,
+			statusCode: http.StatusServiceUnavailable,
+			attempts:   1,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var bodies []string
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := ioutil.ReadAll(r.Body)
+				bodies = append(bodies, string(b))
+
+				// Fail the first attempt so that it has to be retried
+				if len(bodies) == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer upstream.Close()
+
+			h := handler{
+				l:                       log.NewNopLogger(),
+				optionProxyURL:          upstream.URL,
+				optionProxyRetries:      c.retries,
+				optionProxyBufferBytes:  c.bufferSize,
+				optionProxyMaxBodyBytes: c.maxBody,
+			}
+
+			var proxy http.Handler = http.HandlerFunc(h.proxyHandler)
+			if c.budget > 0 {
+				proxy = withBudget(proxy, c.budget)
+			}
+
+			rr := httptest.NewRecorder()
+			proxy.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/proxy", strings.NewReader(c.body)))
+
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.statusCode)
+			}
+			if len(bodies) != c.attempts {
+				t.Errorf("expected attempts to match; got: %v, want: %v", len(bodies), c.attempts)
+			}
+			for i, b := range bodies {
+				if b != c.body {
+					t.Errorf("expected attempt %d to send the whole body; got %d bytes, want: %d", i+1, len(b), len(c.body))
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkProxyHandlerClient(b *testing.B) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("unit-test"))
+	}))
+	defer upstream.Close()
+
+	h := handler{
+		l:              log.NewNopLogger(),
+		optionProxyURL: upstream.URL,
+	}
+
+	b.Run("per request client", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			h.proxyClient = NewProxyClient(100, 90*time.Second, 30*time.Second, nil, nil)
+			h.proxyHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/proxy", nil))
+			h.proxyClient.CloseIdleConnections()
+		}
+	})
+
+	b.Run("shared client", func(b *testing.B) {
+		h.proxyClient = NewProxyClient(100, 90*time.Second, 30*time.Second, nil, nil)
+		defer h.proxyClient.CloseIdleConnections()
+
+		for i := 0; i < b.N; i++ {
+			h.proxyHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/proxy", nil))
+		}
+	})
+}
+
+func TestProxyHandlerEventStream(t *testing.T) {
+	next := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+
+		for i := 0; i < 2; i++ {
+			fmt.Fprintf(w, "data: event %d\n\n", i)
+			w.(http.Flusher).Flush()
+			<-next
+		}
+	}))
+	defer upstream.Close()
+
+	h := handler{
+		l:              log.NewNopLogger(),
+		optionProxyURL: upstream.URL,
+	}
+	proxy := httptest.NewServer(http.HandlerFunc(h.proxyHandler))
+	defer proxy.Close()
+
+	r, err := http.NewRequest(http.MethodGet, proxy.URL, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	r.Header.Set("Accept", "text/event-stream")
+
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer resp.Body.Close()
+
+	if got := resp.Header.Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("expected caching to be disabled; got: %q", got)
+	}
+
+	// Each event has to arrive before the upstream sends the next one
+	events := bufio.NewReader(resp.Body)
+	for i := 0; i < 2; i++ {
+		line, err := events.ReadString('\n')
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if want := fmt.Sprintf("data: event %d\n", i); line != want {
+			t.Errorf("expected events to match; got: %q, want: %q", line, want)
+		}
+		events.ReadString('\n')
+		next <- struct{}{}
+	}
+}
+
+func TestProxyHandlerCancellation(t *testing.T) {
+	received := make(chan struct{})
+	cancelled := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		select {
+		case <-r.Context().Done():
+			close(cancelled)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer upstream.Close()
+
+	h := handler{
+		l:                  log.NewNopLogger(),
+		optionProxyURL:     upstream.URL,
+		optionProxyRetries: 2,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodPost, "/v1/proxy", nil).WithContext(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		h.proxyHandler(httptest.NewRecorder(), r)
+		close(done)
+	}()
+
+	<-received
+	cancel()
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("expected the upstream request to be cancelled")
+	}
+	<-done
+}
+
+func TestProxyHandlerRedirects(t *testing.T) {
+	type testCase struct {
+		name          string
+		redirectHosts func(target *url.URL) []string
+		statusCode    int
+		location      bool
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "not followed by default",
+			statusCode: http.StatusFound,
+			location:   true,
+		},
+		testCase{
+			name: "not followed to other hosts",
+			redirectHosts: func(target *url.URL) []string {
+				return []string{"example.com"}
+			},
+			statusCode: http.StatusFound,
+			location:   true,
+		},
+		testCase{
+			name: "followed to allowed hosts",
+			redirectHosts: func(target *url.URL) []string {
+				return []string{target.Host}
+			},
+			statusCode: http.StatusOK,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer target.Close()
+			targetURL, _ := url.Parse(target.URL)
+
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, target.URL, http.StatusFound)
+			}))
+			defer upstream.Close()
+
+			var hosts []string
+			if c.redirectHosts != nil {
+				hosts = c.redirectHosts(targetURL)
+			}
+			h := handler{
+				l:              log.NewNopLogger(),
+				optionProxyURL: upstream.URL,
+				proxyClient:    NewProxyClient(1, time.Second, time.Second, hosts, nil),
+			}
+
+			rr := httptest.NewRecorder()
+			h.proxyHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/proxy", nil))
+
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.statusCode)
+			}
+			if got := rr.Header().Get("Location"); (got == target.URL) != c.location {
+				t.Errorf("expected location to be passed through: %v; got: %q", c.location, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestProxyHandlerCustomCA(t *testing.T) {
+	type testCase struct {
+		name       string
+		trustCA    bool
+		statusCode int
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "system pool",
+			statusCode: http.StatusBadGateway,
+		},
+		testCase{
+			name:       "custom ca",
+			trustCA:    true,
+			statusCode: http.StatusOK,
+		},
+	}
+
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	dir, err := ioutil.TempDir("", "proxy-tls")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	// The test server's certificate is self signed, so it is its own CA
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var file string
+			if c.trustCA {
+				file = caFile
+			}
+			tlsConfig, err := LoadProxyTLSConfig(file, "", "")
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			h := handler{
+				l:              log.NewNopLogger(),
+				optionProxyURL: upstream.URL,
+				proxyClient:    NewProxyClient(1, time.Second, time.Second, nil, tlsConfig),
+			}
+
+			rr := httptest.NewRecorder()
+			h.proxyHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/proxy", nil))
+
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.statusCode)
+			}
+		})
+	}
+}
+
+func TestLoadProxyTLSConfigErrors(t *testing.T) {
+	type testCase struct {
+		name     string
+		contents string
+		certFile bool
+	}
+
+	cases := []testCase{
+		testCase{
+			name:     "no certificates in bundle",
+			contents: "unit-test",
+		},
+		testCase{
+			name:     "client certificate without a key",
+			certFile: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "proxy-tls")
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			defer os.RemoveAll(dir)
+
+			file := filepath.Join(dir, "unit-test.pem")
+			if err := ioutil.WriteFile(file, []byte(c.contents), 0600); err != nil {
+				t.Fatal(err.Error())
+			}
+
+			var caFile, certFile string
+			if c.certFile {
+				certFile = file
+			} else {
+				caFile = file
+			}
+
+			if _, err := LoadProxyTLSConfig(caFile, certFile, ""); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimitResult is the outcome of taking a token from a client's bucket.
+type rateLimitResult struct {
+	// Allowed is true when the request fits within the limit.
+	Allowed bool
+
+	// Limit is the maximum number of requests a client can burst.
+	Limit int
+
+	// Remaining is the number of whole tokens left in the bucket.
+	Remaining int
+
+	// Reset is how long until the bucket is completely refilled.
+	Reset time.Duration
+
+	// RetryAfter is how long until the next token is available. It is only
+	// set when the request is not allowed.
+	RetryAfter time.Duration
+}
+
+// rateLimitStore keeps track of the token buckets for every rate limited key.
+// The in-memory store is used by default, but anything shared across instances
+// can be swapped in.
+type rateLimitStore interface {
+	Take(key string) rateLimitResult
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// memoryRateLimitStore is a token bucket rate limiter that keeps all of its
+// buckets in memory.
+type memoryRateLimitStore struct {
+	rate  float64
+	burst int
+	now   func() time.Time
+
+	mutex     sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// ValidateRateLimit checks that a rate limit of rate requests per second can
+// let any request through. A burst below 1 never has a whole token to take, so
+// it would reject every request rather than limit them. A rate of zero turns
+// rate limiting off and is always valid.
+func ValidateRateLimit(rate float64, burst int) error {
+	if rate < 0 {
+		return fmt.Errorf("rate limit %v must not be negative", rate)
+	}
+	if rate > 0 && burst < 1 {
+		return fmt.Errorf("rate limit burst %d must be at least 1", burst)
+	}
+	return nil
+}
+
+// newMemoryRateLimitStore creates a store allowing rate requests per second
+// with bursts of up to burst requests per key.
+func newMemoryRateLimitStore(rate float64, burst int) *memoryRateLimitStore {
+	return &memoryRateLimitStore{
+		rate:    rate,
+		burst:   burst,
+		now:     time.Now,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+func (s *memoryRateLimitStore) Take(key string) rateLimitResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(s.burst), last: now}
+		s.buckets[key] = b
+	}
+
+	// Refill the bucket for the time that has passed since we last saw this key
+	b.tokens = math.Min(float64(s.burst), b.tokens+now.Sub(b.last).Seconds()*s.rate)
+	b.last = now
+
+	res := rateLimitResult{
+		Limit: s.burst,
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = s.durationFor(1 - b.tokens)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = s.durationFor(float64(s.burst) - b.tokens)
+
+	return res
+}
+
+// sweep drops any buckets that would have refilled completely, since they are
+// no different than a key we have never seen. It only runs once a minute so
+// that it doesn't slow down every request.
+func (s *memoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*s.rate >= float64(s.burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func (s *memoryRateLimitStore) durationFor(tokens float64) time.Duration {
+	return time.Duration(tokens / s.rate * float64(time.Second))
+}
+
+// rateLimitByIP keys the rate limit by the address of the client.
+func rateLimitByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimitByWriteKey keys the rate limit by the write key checked by
+// withBasicWriteKey, falling back to the client address for requests without
+// one. Unchecked basic auth usernames are never used, since anyone could pick
+// a fresh one for every request.
+func rateLimitByWriteKey(r *http.Request) string {
+	writeKey, ok := writeKeyFromContext(r.Context())
+	if !ok || writeKey == "" {
+		return rateLimitByIP(r)
+	}
+	return "writeKey:" + writeKey
+}
+
+// rateLimitBySubject keys the rate limit by the subject of the token verified
+// by withJWT, so that every user has a limit of their own, falling back to
+// rateLimitByWriteKey for requests without one.
+func rateLimitBySubject(r *http.Request) string {
+	claims, ok := claimsFromContext(r.Context())
+	if !ok || claims.Subject == "" {
+		return rateLimitByWriteKey(r)
+	}
+	return "sub:" + claims.Subject
+}
+
+// withRateLimit rejects requests with a 429 once the client identified by key
+// has used up its tokens in store.
+func withRateLimit(next http.Handler, store rateLimitStore, key func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res := store.Take(key(r))
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+		if !res.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			sendError(w, r, http.StatusTooManyRequests, fmt.Sprintf("rate limit of %d requests exceeded", res.Limit))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
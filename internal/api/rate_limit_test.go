@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestWithRateLimit(t *testing.T) {
+	type testCase struct {
+		name       string
+		requests   int
+		elapsed    time.Duration
+		statusCode int
+		headers    map[string]string
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "within burst",
+			requests:   2,
+			statusCode: http.StatusOK,
+			headers: map[string]string{
+				"X-RateLimit-Limit":     "2",
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     "2",
+				"Retry-After":           "",
+			},
+		},
+		testCase{
+			name:       "exceeds burst",
+			requests:   3,
+			statusCode: http.StatusTooManyRequests,
+			headers: map[string]string{
+				"X-RateLimit-Limit":     "2",
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     "2",
+				"Retry-After":           "1",
+			},
+		},
+		testCase{
+			name:       "refilled after waiting",
+			requests:   3,
+			elapsed:    time.Second,
+			statusCode: http.StatusOK,
+			headers: map[string]string{
+				"X-RateLimit-Limit":     "2",
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     "2",
+				"Retry-After":           "",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			now := time.Now()
+			store := newMemoryRateLimitStore(1, 2)
+			store.now = func() time.Time { return now }
+
+			h := withRateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}), store, rateLimitByIP)
+
+			var rr *httptest.ResponseRecorder
+			for i := 0; i < c.requests; i++ {
+				if i == c.requests-1 {
+					now = now.Add(c.elapsed)
+				}
+				rr = httptest.NewRecorder()
+				h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/proxy", nil))
+			}
+
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.statusCode)
+			}
+			for header, want := range c.headers {
+				if got := rr.Header().Get(header); got != want {
+					t.Errorf("expected %s headers to match; got: %q, want: %q", header, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	type testCase struct {
+		name     string
+		username string
+		writeKey string
+		sub      string
+		want     string
+	}
+
+	cases := []testCase{
+		testCase{
+			name: "address",
+			want: "192.0.2.1",
+		},
+		testCase{
+			name:     "unchecked username",
+			username: "key-a",
+			want:     "192.0.2.1",
+		},
+		testCase{
+			name:     "write key",
+			username: "key-a",
+			writeKey: "key-a",
+			want:     "writeKey:key-a",
+		},
+		testCase{
+			name:     "token subject",
+			writeKey: "key-a",
+			sub:      "user-a",
+			want:     "sub:user-a",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/v1/proxy", nil)
+			if c.username != "" {
+				r.SetBasicAuth(c.username, "")
+			}
+
+			ctx := r.Context()
+			if c.writeKey != "" {
+				ctx = context.WithValue(ctx, contextKeyWriteKey, c.writeKey)
+			}
+			if c.sub != "" {
+				ctx = context.WithValue(ctx, contextKeyToken, newTestToken("unit-test", c.sub, ""))
+			}
+
+			if got := rateLimitBySubject(r.WithContext(ctx)); got != c.want {
+				t.Errorf("expected keys to match; got: %q, want: %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestNewRouterRateLimitsWriteKeys(t *testing.T) {
+	h := handler{
+		l:                    log.NewNopLogger(),
+		optionProxyURL:       "http://127.0.0.1:0",
+		optionRateLimit:      1,
+		optionRateLimitBurst: 1,
+		optionWriteKeys:      []string{"key-a"},
+	}
+	router := newRouter(h, disabledNewRelicApp())
+
+	// Made up write keys are rejected before they can each get a limit of
+	// their own, while a valid one is limited
+	requests := []struct {
+		writeKey   string
+		statusCode int
+	}{
+		{"made-up-1", http.StatusUnauthorized},
+		{"made-up-2", http.StatusUnauthorized},
+		{"key-a", http.StatusBadGateway},
+		{"key-a", http.StatusTooManyRequests},
+	}
+	for _, req := range requests {
+		r := httptest.NewRequest(http.MethodPost, "/v1/proxy", nil)
+		r.SetBasicAuth(req.writeKey, "")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, r)
+
+		if rr.Code != req.statusCode {
+			t.Errorf("expected status codes to match for %s; got: %v, want %v", req.writeKey, rr.Code, req.statusCode)
+		}
+	}
+}
+
+func TestValidateRateLimit(t *testing.T) {
+	type testCase struct {
+		name    string
+		rate    float64
+		burst   int
+		wantErr bool
+	}
+
+	cases := []testCase{
+		testCase{
+			name:  "valid",
+			rate:  1,
+			burst: 1,
+		},
+		testCase{
+			name: "disabled",
+		},
+		testCase{
+			name:    "zero burst",
+			rate:    1,
+			wantErr: true,
+		},
+		testCase{
+			name:    "negative rate",
+			rate:    -1,
+			burst:   1,
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateRateLimit(c.rate, c.burst)
+			if (err != nil) != c.wantErr {
+				t.Errorf("expected error to match; got: %v, want error: %v", err, c.wantErr)
+			}
+		})
+	}
+}
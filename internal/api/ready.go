@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReadinessCheck reports an error when a dependency isn't ready to be used.
+type ReadinessCheck func(ctx context.Context) error
+
+// Readiness is the registry of checks that must pass before the service is
+// ready to accept traffic.
+type Readiness struct {
+	mutex    sync.RWMutex
+	checks   map[string]ReadinessCheck
+	draining bool
+}
+
+// NewReadiness creates a registry without any checks, which is always ready.
+func NewReadiness() *Readiness {
+	return &Readiness{
+		checks: make(map[string]ReadinessCheck),
+	}
+}
+
+// Register adds a named check. Every check is given at most timeout to finish
+// so that one slow dependency can't hang the probe.
+func (rd *Readiness) Register(name string, timeout time.Duration, check ReadinessCheck) {
+	rd.mutex.Lock()
+	defer rd.mutex.Unlock()
+
+	rd.checks[name] = func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		return check(ctx)
+	}
+}
+
+// Drain makes the readiness probe fail from now on, without running any
+// checks, so that load balancers stop sending traffic before the server shuts
+// down. Requests that still arrive are served as usual.
+func (rd *Readiness) Drain() {
+	rd.mutex.Lock()
+	defer rd.mutex.Unlock()
+
+	rd.draining = true
+}
+
+type readinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// handler runs every check concurrently, responding with a 503 if any of them
+// fail or the service is draining.
+func (rd *Readiness) handler(w http.ResponseWriter, r *http.Request) {
+	rd.mutex.RLock()
+	if rd.draining {
+		rd.mutex.RUnlock()
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(readinessResponse{Status: "draining"})
+		return
+	}
+
+	names := make([]string, 0, len(rd.checks))
+	for name := range rd.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, check ReadinessCheck) {
+			defer wg.Done()
+			errs[i] = check(r.Context())
+		}(i, rd.checks[name])
+	}
+	rd.mutex.RUnlock()
+	wg.Wait()
+
+	resp := readinessResponse{
+		Status: "ready",
+		Checks: make(map[string]string, len(names)),
+	}
+	status := http.StatusOK
+	for i, name := range names {
+		resp.Checks[name] = "ok"
+		if errs[i] != nil {
+			resp.Checks[name] = errs[i].Error()
+			resp.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// CachedCheck runs check at most once per ttl, answering with its last result
+// in between, so that frequent probes from every load balancer don't each
+// reach the dependency. Results of checks cut short by the probe's own context
+// aren't kept, since they say nothing about the dependency.
+func CachedCheck(check ReadinessCheck, ttl time.Duration) ReadinessCheck {
+	var (
+		mutex   sync.Mutex
+		err     error
+		checked time.Time
+	)
+
+	return func(ctx context.Context) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if !checked.IsZero() && time.Since(checked) < ttl {
+			return err
+		}
+
+		result := check(ctx)
+		if ctx.Err() == nil {
+			err, checked = result, time.Now()
+		}
+		return result
+	}
+}
+
+// JWKSCheck checks that the Auth0 tenant's JSON web key set, which is needed to
+// verify tokens, can be fetched. client should be separate from the one used to
+// verify tokens, so that the probe doesn't count towards its circuit breaker
+// or fail just because the circuit is open.
+func JWKSCheck(client *http.Client, tenantURL string) ReadinessCheck {
+	keyURL := strings.TrimRight(tenantURL, "/") + "/.well-known/jwks.json"
+
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, keyURL, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("received %d status code fetching keys", resp.StatusCode)
+		}
+
+		return nil
+	}
+}
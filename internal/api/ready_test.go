@@ -0,0 +1,220 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestReadinessHandler(t *testing.T) {
+	type testCase struct {
+		name       string
+		checks     map[string]ReadinessCheck
+		draining   bool
+		statusCode int
+		resp       readinessResponse
+	}
+
+	ok := func(ctx context.Context) error { return nil }
+	failing := func(ctx context.Context) error { return errors.New("unit-test") }
+	slow := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "no checks",
+			statusCode: http.StatusOK,
+			resp: readinessResponse{
+				Status: "ready",
+			},
+		},
+		testCase{
+			name: "all passing",
+			checks: map[string]ReadinessCheck{
+				"a": ok,
+				"b": ok,
+			},
+			statusCode: http.StatusOK,
+			resp: readinessResponse{
+				Status: "ready",
+				Checks: map[string]string{"a": "ok", "b": "ok"},
+			},
+		},
+		testCase{
+			name: "failing",
+			checks: map[string]ReadinessCheck{
+				"a": ok,
+				"b": failing,
+			},
+			statusCode: http.StatusServiceUnavailable,
+			resp: readinessResponse{
+				Status: "unavailable",
+				Checks: map[string]string{"a": "ok", "b": "unit-test"},
+			},
+		},
+		testCase{
+			name: "timed out",
+			checks: map[string]ReadinessCheck{
+				"a": slow,
+			},
+			statusCode: http.StatusServiceUnavailable,
+			resp: readinessResponse{
+				Status: "unavailable",
+				Checks: map[string]string{"a": context.DeadlineExceeded.Error()},
+			},
+		},
+		testCase{
+			name: "draining",
+			checks: map[string]ReadinessCheck{
+				"a": ok,
+			},
+			draining:   true,
+			statusCode: http.StatusServiceUnavailable,
+			resp: readinessResponse{
+				Status: "draining",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rd := NewReadiness()
+			for name, check := range c.checks {
+				rd.Register(name, 10*time.Millisecond, check)
+			}
+			if c.draining {
+				rd.Drain()
+			}
+
+			rr := httptest.NewRecorder()
+			rd.handler(rr, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+			var resp readinessResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err.Error())
+			}
+
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.statusCode)
+			}
+			if !reflect.DeepEqual(resp, c.resp) {
+				t.Errorf("expected responses to match; got: %v, want: %v", resp, c.resp)
+			}
+		})
+	}
+}
+
+func TestReadinessDrain(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer upstream.Close()
+
+	rd := NewReadiness()
+	app := httptest.NewServer(New(Config{ProxyURL: upstream.URL}, Deps{Ready: rd}))
+	defer app.Close()
+
+	inFlight := make(chan int)
+	go func() {
+		resp, err := http.Post(app.URL+"/v1/proxy", "application/json", nil)
+		if err != nil {
+			inFlight <- 0
+			return
+		}
+		resp.Body.Close()
+		inFlight <- resp.StatusCode
+	}()
+
+	rd.Drain()
+
+	for path, want := range map[string]int{"/ready": http.StatusServiceUnavailable, "/health": http.StatusOK} {
+		resp, err := http.Get(app.URL + path)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != want {
+			t.Errorf("expected %s status codes to match while draining; got: %v, want %v", path, resp.StatusCode, want)
+		}
+	}
+
+	close(release)
+	if got := <-inFlight; got != http.StatusOK {
+		t.Errorf("expected in flight request to be served while draining; got: %v, want %v", got, http.StatusOK)
+	}
+}
+
+func TestJWKSCheck(t *testing.T) {
+	type testCase struct {
+		name   string
+		status int
+		err    bool
+	}
+
+	cases := []testCase{
+		testCase{
+			name:   "reachable",
+			status: http.StatusOK,
+		},
+		testCase{
+			name:   "failing",
+			status: http.StatusInternalServerError,
+			err:    true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tenant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/.well-known/jwks.json" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.WriteHeader(c.status)
+				w.Write([]byte(`{"keys":[]}`))
+			}))
+			defer tenant.Close()
+
+			err := JWKSCheck(tenant.Client(), tenant.URL+"/")(context.Background())
+			if (err != nil) != c.err {
+				t.Errorf("expected error: %v; got: %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestCachedCheck(t *testing.T) {
+	calls := 0
+	check := CachedCheck(func(ctx context.Context) error {
+		calls++
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return errors.New("unit-test: failure " + strconv.Itoa(calls))
+	}, time.Hour)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := check(cancelled); err == nil {
+		t.Fatal("expected the cancelled check to fail")
+	}
+
+	first := check(context.Background())
+	second := check(context.Background())
+	if first == nil || second == nil || first.Error() != second.Error() {
+		t.Errorf("expected the result to be cached; got: %v, then: %v", first, second)
+	}
+	if calls != 2 {
+		t.Errorf("expected the check to run once more after being cut short; got: %v, want: %v", calls, 2)
+	}
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// replayBuffer holds a request body so that it can be read more than once.
+// Bodies up to a threshold are kept in memory, anything bigger is spilled to a
+// temporary file so that large bodies can't exhaust our memory.
+type replayBuffer struct {
+	mem  []byte
+	file *os.File
+	size int64
+}
+
+// newReplayBuffer reads all of r, keeping up to max bytes in memory. Bodies
+// bigger than limit bytes fail with a bodyTooLargeError, so that they can't
+// fill up the disk either. There is no limit when it is zero. Close must be
+// called to clean up the temporary file once the body is no longer needed.
+func newReplayBuffer(r io.Reader, max, limit int64) (*replayBuffer, error) {
+	r = limitBody(ioutil.NopCloser(r), limit)
+
+	var mem bytes.Buffer
+	n, err := io.CopyN(&mem, r, max+1)
+	if err == io.EOF {
+		return &replayBuffer{mem: mem.Bytes(), size: n}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The body is bigger than we are willing to hold in memory
+	f, err := ioutil.TempFile("", "proxy-body-")
+	if err != nil {
+		return nil, err
+	}
+	b := &replayBuffer{file: f}
+
+	if _, err := f.Write(mem.Bytes()); err != nil {
+		b.Close()
+		return nil, err
+	}
+	rest, err := io.Copy(f, r)
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+	b.size = n + rest
+
+	return b, nil
+}
+
+// Reader returns a new reader from the start of the buffered body.
+func (b *replayBuffer) Reader() io.Reader {
+	if b.file == nil {
+		return bytes.NewReader(b.mem)
+	}
+	return io.NewSectionReader(b.file, 0, b.size)
+}
+
+// Size is the length of the buffered body.
+func (b *replayBuffer) Size() int64 {
+	return b.size
+}
+
+// Close removes the temporary file if the body was spilled to disk.
+func (b *replayBuffer) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	b.file.Close()
+	return os.Remove(b.file.Name())
+}
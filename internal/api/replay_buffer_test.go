@@ -0,0 +1,131 @@
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReplayBuffer(t *testing.T) {
+	type testCase struct {
+		name    string
+		body    string
+		max     int64
+		spilled bool
+	}
+
+	cases := []testCase{
+		testCase{
+			name: "in memory",
+			body: "unit-test",
+			max:  1024,
+		},
+		testCase{
+			name: "exactly the threshold",
+			body: "unit-test",
+			max:  9,
+		},
+		testCase{
+			name:    "spilled to disk",
+			body:    strings.Repeat("unit-test", 100),
+			max:     16,
+			spilled: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b, err := newReplayBuffer(strings.NewReader(c.body), c.max, 0)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			if spilled := b.file != nil; spilled != c.spilled {
+				t.Errorf("expected spilled to match; got: %v, want: %v", spilled, c.spilled)
+			}
+			if b.Size() != int64(len(c.body)) {
+				t.Errorf("expected sizes to match; got: %v, want: %v", b.Size(), len(c.body))
+			}
+
+			// Every reader should replay the whole body
+			for i := 0; i < 2; i++ {
+				got, err := ioutil.ReadAll(b.Reader())
+				if err != nil {
+					t.Fatal(err.Error())
+				}
+				if string(got) != c.body {
+					t.Errorf("expected replayed bodies to match; got: %q, want: %q", got, c.body)
+				}
+			}
+
+			if err := b.Close(); err != nil {
+				t.Error(err.Error())
+			}
+			if c.spilled {
+				if _, err := os.Stat(b.file.Name()); !os.IsNotExist(err) {
+					t.Errorf("expected temporary file to be removed; got: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestReplayBufferLimit(t *testing.T) {
+	type testCase struct {
+		name  string
+		body  string
+		max   int64
+		limit int64
+		err   bool
+	}
+
+	cases := []testCase{
+		testCase{
+			name:  "spilled within the limit",
+			body:  strings.Repeat("unit-test", 100),
+			max:   16,
+			limit: 900,
+		},
+		testCase{
+			name:  "spilled over the limit",
+			body:  strings.Repeat("unit-test", 100),
+			max:   16,
+			limit: 899,
+			err:   true,
+		},
+		testCase{
+			name:  "in memory over the limit",
+			body:  strings.Repeat("unit-test", 100),
+			max:   1024,
+			limit: 16,
+			err:   true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			before, _ := filepath.Glob(filepath.Join(os.TempDir(), "proxy-body-*"))
+
+			b, err := newReplayBuffer(strings.NewReader(c.body), c.max, c.limit)
+			if c.err {
+				if !isBodyTooLarge(err) {
+					t.Errorf("expected a body too large error; got: %v", err)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err.Error())
+				}
+				if b.Size() != int64(len(c.body)) {
+					t.Errorf("expected sizes to match; got: %v, want: %v", b.Size(), len(c.body))
+				}
+				b.Close()
+			}
+
+			if after, _ := filepath.Glob(filepath.Join(os.TempDir(), "proxy-body-*")); len(after) != len(before) {
+				t.Errorf("expected temporary files to be removed; got: %v, want: %v", after, before)
+			}
+		})
+	}
+}
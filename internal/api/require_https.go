@@ -0,0 +1,37 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// withRequireHTTPS responds with a 400 to requests that weren't made over
+// https. When TLS is terminated in front of us, the scheme the client used is
+// read from protoHeader, such as X-Forwarded-Proto. It must only be set when
+// every request comes through a proxy that sets it, since clients could
+// otherwise claim https themselves. A request without the header is treated as
+// cleartext.
+func withRequireHTTPS(next http.Handler, protoHeader string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isHTTPS(r, protoHeader) {
+			sendError(w, r, http.StatusBadRequest, "requests must be made over https")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isHTTPS reports whether r was made over https, trusting protoHeader when it
+// is set. Proxies that append to the header put the client's scheme first.
+func isHTTPS(r *http.Request, protoHeader string) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if protoHeader == "" {
+		return false
+	}
+
+	proto := strings.Split(r.Header.Get(protoHeader), ",")[0]
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithRequireHTTPS(t *testing.T) {
+	type testCase struct {
+		name        string
+		protoHeader string
+		proto       string
+		tls         bool
+		statusCode  int
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "tls",
+			tls:        true,
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "cleartext",
+			statusCode: http.StatusBadRequest,
+		},
+		testCase{
+			name:        "forwarded https",
+			protoHeader: "X-Forwarded-Proto",
+			proto:       "https",
+			statusCode:  http.StatusOK,
+		},
+		testCase{
+			name:        "forwarded https through several proxies",
+			protoHeader: "X-Forwarded-Proto",
+			proto:       "HTTPS, http",
+			statusCode:  http.StatusOK,
+		},
+		testCase{
+			name:        "forwarded http",
+			protoHeader: "X-Forwarded-Proto",
+			proto:       "http",
+			statusCode:  http.StatusBadRequest,
+		},
+		testCase{
+			name:        "missing proto",
+			protoHeader: "X-Forwarded-Proto",
+			statusCode:  http.StatusBadRequest,
+		},
+		testCase{
+			name:       "untrusted proto",
+			proto:      "https",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := withRequireHTTPS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), c.protoHeader)
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/proxy", nil)
+			if c.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", c.proto)
+			}
+			if c.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", w.Code, c.statusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// withRequireHeaders responds with a 400 listing every header in names that
+// is missing or empty on the request.
+func withRequireHeaders(next http.Handler, names ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var errs []errorValidation
+		for _, name := range names {
+			if strings.TrimSpace(r.Header.Get(name)) == "" {
+				errs = append(errs, errorValidation{Field: name, Reason: "header is required"})
+			}
+		}
+		if len(errs) > 0 {
+			sendValidationErrors(w, r, errs)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
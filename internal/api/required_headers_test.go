@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestWithRequireHeaders(t *testing.T) {
+	type testCase struct {
+		name       string
+		header     map[string]string
+		statusCode int
+		errors     []errorValidation
+	}
+
+	cases := []testCase{
+		testCase{
+			name: "all present",
+			header: map[string]string{
+				"X-Tenant-ID":  "unit-test",
+				"X-Request-ID": "unit-test",
+			},
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name: "one missing",
+			header: map[string]string{
+				"X-Request-ID": "unit-test",
+			},
+			statusCode: http.StatusBadRequest,
+			errors: []errorValidation{
+				errorValidation{Field: "X-Tenant-ID", Reason: "header is required"},
+			},
+		},
+		testCase{
+			name: "empty value",
+			header: map[string]string{
+				"X-Tenant-ID":  " ",
+				"X-Request-ID": "",
+			},
+			statusCode: http.StatusBadRequest,
+			errors: []errorValidation{
+				errorValidation{Field: "X-Tenant-ID", Reason: "header is required"},
+				errorValidation{Field: "X-Request-ID", Reason: "header is required"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := withRequireHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), "X-Tenant-ID", "X-Request-ID")
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/proxy", nil)
+			for name, value := range c.header {
+				r.Header.Set(name, value)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.statusCode)
+			}
+			if c.statusCode == http.StatusOK {
+				return
+			}
+
+			var resp apiError
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err.Error())
+			}
+			if !reflect.DeepEqual(resp.Errors, c.errors) {
+				t.Errorf("expected errors to match; got: %v, want: %v", resp.Errors, c.errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cachedResponse is a response held by a responseCacheStore.
+type cachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// responseCacheStore holds the responses cached by withResponseCache. The
+// in-memory store is used by default, but anything shared across instances can
+// be swapped in.
+type responseCacheStore interface {
+	// Get returns the response stored under key and how long ago it was
+	// stored. Responses older than their TTL are never returned.
+	Get(key string) (resp cachedResponse, age time.Duration, ok bool)
+
+	// Set stores resp under key for ttl.
+	Set(key string, resp cachedResponse, ttl time.Duration)
+}
+
+type responseCacheEntry struct {
+	resp    cachedResponse
+	stored  time.Time
+	expires time.Time
+}
+
+// memoryResponseCacheStore keeps every cached response in memory.
+type memoryResponseCacheStore struct {
+	now func() time.Time
+
+	mutex     sync.Mutex
+	entries   map[string]responseCacheEntry
+	lastSweep time.Time
+}
+
+func newMemoryResponseCacheStore() *memoryResponseCacheStore {
+	return &memoryResponseCacheStore{
+		now:     time.Now,
+		entries: make(map[string]responseCacheEntry),
+	}
+}
+
+func (s *memoryResponseCacheStore) Get(key string) (cachedResponse, time.Duration, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	e, ok := s.entries[key]
+	if !ok || !now.Before(e.expires) {
+		return cachedResponse{}, 0, false
+	}
+	return e.resp, now.Sub(e.stored), true
+}
+
+func (s *memoryResponseCacheStore) Set(key string, resp cachedResponse, ttl time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	s.entries[key] = responseCacheEntry{
+		resp:    resp,
+		stored:  now,
+		expires: now.Add(ttl),
+	}
+}
+
+// sweep drops any expired entries so that keys which are never requested
+// again don't stay in memory. It only runs once a minute so that it doesn't
+// slow down every request.
+func (s *memoryResponseCacheStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// responseCacheKey keys cached responses by the request path and query, the
+// caller and the values of headers, such as X-Tenant-ID, so that one caller is
+// never served another's response. The caller is the subject of the verified
+// token and the checked write key, whichever the request has. The key is hashed so
+// that credentials are never kept in the store.
+func responseCacheKey(headers ...string) func(*http.Request) string {
+	return func(r *http.Request) string {
+		var b strings.Builder
+		b.WriteString(r.URL.RequestURI())
+		if claims, ok := claimsFromContext(r.Context()); ok {
+			b.WriteString("\x00sub=" + claims.Subject)
+		}
+		if writeKey, ok := writeKeyFromContext(r.Context()); ok {
+			b.WriteString("\x00writeKey=" + writeKey)
+		}
+		for _, name := range headers {
+			b.WriteString("\x00" + http.CanonicalHeaderKey(name) + "=" + strings.Join(r.Header.Values(name), ","))
+		}
+
+		sum := sha256.Sum256([]byte(b.String()))
+		return hex.EncodeToString(sum[:])
+	}
+}
+
+// proxyCacheKeyHeaders are the headers cached proxy responses are keyed by:
+// the required headers, which usually say who the request is for, and any
+// others that have been configured.
+func (h handler) proxyCacheKeyHeaders() []string {
+	headers := append([]string(nil), h.optionProxyRequiredHeaders...)
+	return append(headers, h.optionProxyCacheKeyHeaders...)
+}
+
+// cacheResponseWriter passes the response through while keeping a copy of it
+// to be cached. The handler is given a header map of its own, so that only the
+// headers it sets are cached and not the ones set by the middleware around it,
+// such as traceparent, which belong to a single request. Streamed responses
+// are never cached.
+type cacheResponseWriter struct {
+	w         http.ResponseWriter
+	header    http.Header
+	status    int
+	cached    http.Header
+	buf       bytes.Buffer
+	streaming bool
+}
+
+func (w *cacheResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *cacheResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+		w.cached = w.header.Clone()
+		copyHeader(w.w.Header(), w.header)
+	}
+	w.w.WriteHeader(status)
+}
+
+// writeTrailers copies the headers set after the response was written, which
+// are the trailers, onto the response.
+func (w *cacheResponseWriter) writeTrailers() {
+	for name, values := range w.header {
+		if _, ok := w.cached[name]; !ok {
+			w.w.Header()[name] = values
+		}
+	}
+}
+
+func (w *cacheResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.streaming {
+		w.buf.Write(b)
+	}
+	return w.w.Write(b)
+}
+
+func (w *cacheResponseWriter) Flush() {
+	w.streaming = true
+	if f, ok := w.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// withResponseCache serves successful GET responses from store for ttl after
+// they were first served, setting the Age header on cached responses. Requests
+// with Cache-Control: no-cache always go to next and aren't cached, and neither
+// are responses with trailers.
+func withResponseCache(next http.Handler, store responseCacheStore, ttl time.Duration, key func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || noCache(r.Header.Get("Cache-Control")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		k := key(r)
+		if resp, age, ok := store.Get(k); ok {
+			copyHeader(w.Header(), resp.Header)
+			w.Header().Set("Age", strconv.Itoa(int(age.Seconds())))
+			w.WriteHeader(resp.Status)
+			w.Write(resp.Body)
+			return
+		}
+
+		cw := &cacheResponseWriter{
+			w:      w,
+			header: make(http.Header),
+		}
+		next.ServeHTTP(cw, r)
+
+		// Nothing written is an empty 200
+		if cw.status == 0 {
+			cw.WriteHeader(http.StatusOK)
+		}
+		cw.writeTrailers()
+		if cw.streaming || cw.status < 200 || cw.status >= 300 {
+			return
+		}
+		// Only the trailers' names are in the header, their values would be
+		// lost when the response is served from the cache
+		if len(cw.cached.Values("Trailer")) > 0 {
+			return
+		}
+		store.Set(k, cachedResponse{
+			Status: cw.status,
+			Header: cw.cached,
+			Body:   cw.buf.Bytes(),
+		}, ttl)
+	})
+}
+
+// copyHeader adds every value in src to dst.
+func copyHeader(dst, src http.Header) {
+	for name, values := range src {
+		for _, v := range values {
+			dst.Add(name, v)
+		}
+	}
+}
+
+func noCache(cacheControl string) bool {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-cache") {
+			return true
+		}
+	}
+	return false
+}
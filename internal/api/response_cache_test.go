@@ -0,0 +1,315 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestWithResponseCache(t *testing.T) {
+	type testCase struct {
+		name         string
+		method       string
+		cacheControl string
+		status       int
+		elapsed      time.Duration
+		calls        int
+		body         string
+		age          string
+	}
+
+	cases := []testCase{
+		testCase{
+			name:    "hit",
+			method:  http.MethodGet,
+			status:  http.StatusOK,
+			elapsed: 2 * time.Second,
+			calls:   1,
+			body:    "response 1",
+			age:     "2",
+		},
+		testCase{
+			name:    "expired",
+			method:  http.MethodGet,
+			status:  http.StatusOK,
+			elapsed: 5 * time.Second,
+			calls:   2,
+			body:    "response 2",
+		},
+		testCase{
+			name:    "miss on error",
+			method:  http.MethodGet,
+			status:  http.StatusBadGateway,
+			elapsed: 2 * time.Second,
+			calls:   2,
+			body:    "response 2",
+		},
+		testCase{
+			name:    "miss on post",
+			method:  http.MethodPost,
+			status:  http.StatusOK,
+			elapsed: 2 * time.Second,
+			calls:   2,
+			body:    "response 2",
+		},
+		testCase{
+			name:         "no-cache",
+			method:       http.MethodGet,
+			cacheControl: "max-age=0, no-cache",
+			status:       http.StatusOK,
+			elapsed:      2 * time.Second,
+			calls:        2,
+			body:         "response 2",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			now := time.Now()
+			store := newMemoryResponseCacheStore()
+			store.now = func() time.Time { return now }
+
+			var calls int
+			h := withResponseCache(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.Header().Set("Content-Type", "text/plain")
+				w.WriteHeader(c.status)
+				fmt.Fprintf(w, "response %d", calls)
+			}), store, 5*time.Second, responseCacheKey())
+
+			var rr *httptest.ResponseRecorder
+			for i := 0; i < 2; i++ {
+				if i == 1 {
+					now = now.Add(c.elapsed)
+				}
+				r := httptest.NewRequest(c.method, "/v1/proxy?page=1", nil)
+				r.Header.Set("Cache-Control", c.cacheControl)
+				rr = httptest.NewRecorder()
+				h.ServeHTTP(rr, r)
+			}
+
+			if calls != c.calls {
+				t.Errorf("expected upstream calls to match; got: %v, want: %v", calls, c.calls)
+			}
+			if rr.Code != c.status {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.status)
+			}
+			if got := rr.Body.String(); got != c.body {
+				t.Errorf("expected bodies to match; got: %q, want: %q", got, c.body)
+			}
+			if got := rr.Header().Get("Content-Type"); got != "text/plain" {
+				t.Errorf("expected content types to match; got: %q, want: %q", got, "text/plain")
+			}
+			if got := rr.Header().Get("Age"); got != c.age {
+				t.Errorf("expected age headers to match; got: %q, want: %q", got, c.age)
+			}
+		})
+	}
+}
+
+func TestResponseCacheKeys(t *testing.T) {
+	type request struct {
+		url      string
+		sub      string
+		writeKey string
+		tenant   string
+	}
+
+	type testCase struct {
+		name     string
+		requests []request
+		calls    int
+	}
+
+	cases := []testCase{
+		testCase{
+			name: "url",
+			requests: []request{
+				request{url: "/v1/proxy?page=1"},
+				request{url: "/v1/proxy?page=2"},
+				request{url: "/v1/proxy?page=1"},
+			},
+			calls: 2,
+		},
+		testCase{
+			name: "token subject",
+			requests: []request{
+				request{url: "/v1/proxy", sub: "client-1"},
+				request{url: "/v1/proxy", sub: "client-2"},
+				request{url: "/v1/proxy", sub: "client-1"},
+			},
+			calls: 2,
+		},
+		testCase{
+			name: "write key",
+			requests: []request{
+				request{url: "/v1/proxy", writeKey: "key-1"},
+				request{url: "/v1/proxy", writeKey: "key-2"},
+				request{url: "/v1/proxy", writeKey: "key-1"},
+			},
+			calls: 2,
+		},
+		testCase{
+			name: "header",
+			requests: []request{
+				request{url: "/v1/proxy", tenant: "tenant-1"},
+				request{url: "/v1/proxy", tenant: "tenant-2"},
+				request{url: "/v1/proxy", tenant: "tenant-1"},
+			},
+			calls: 2,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var calls int
+			h := withResponseCache(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+			}), newMemoryResponseCacheStore(), time.Minute, responseCacheKey("X-Tenant-ID"))
+
+			for _, req := range c.requests {
+				r := httptest.NewRequest(http.MethodGet, req.url, nil)
+				ctx := r.Context()
+				if req.sub != "" {
+					ctx = context.WithValue(ctx, contextKeyToken, newTestToken("unit-test", req.sub, ""))
+				}
+				if req.writeKey != "" {
+					ctx = context.WithValue(ctx, contextKeyWriteKey, req.writeKey)
+				}
+				if req.tenant != "" {
+					r.Header.Set("X-Tenant-ID", req.tenant)
+				}
+				h.ServeHTTP(httptest.NewRecorder(), r.WithContext(ctx))
+			}
+
+			if calls != c.calls {
+				t.Errorf("expected each key to be cached separately; got: %v calls, want: %v", calls, c.calls)
+			}
+		})
+	}
+}
+
+func TestProxyResponseCache(t *testing.T) {
+	var calls int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"calls":%d}`, calls)
+	}))
+	defer upstream.Close()
+
+	h := handler{
+		l:                          log.NewNopLogger(),
+		optionProxyURL:             upstream.URL,
+		optionProxyCacheTTL:        time.Minute,
+		optionProxyRequiredHeaders: []string{"X-Tenant-ID"},
+		optionRateLimit:            10,
+		optionRateLimitBurst:       10,
+	}
+
+	router := newRouter(h, disabledNewRelicApp())
+	get := func(tenant string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/v1/proxy", nil)
+		r.Header.Set("X-Tenant-ID", tenant)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, r)
+		return rr
+	}
+
+	first := get("tenant-1")
+	second := get("tenant-1")
+
+	if calls != 1 {
+		t.Errorf("expected the second request to be served from the cache; got: %v upstream calls, want: %v", calls, 1)
+	}
+	if first.Body.String() != second.Body.String() {
+		t.Errorf("expected bodies to match; got: %q, want: %q", second.Body.String(), first.Body.String())
+	}
+	if got := second.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("expected the upstream headers to be cached; got: %q, want: %q", got, "application/json")
+	}
+
+	// The headers set around the cache belong to each request
+	for _, name := range []string{"traceparent", "X-RateLimit-Remaining"} {
+		if got := second.Header().Values(name); len(got) != 1 || got[0] == first.Header().Get(name) {
+			t.Errorf("expected a fresh %s on the cached response; got: %v, first: %v", name, got, first.Header().Values(name))
+		}
+	}
+
+	get("tenant-2")
+	if calls != 2 {
+		t.Errorf("expected another tenant's request to reach the upstream; got: %v upstream calls, want: %v", calls, 2)
+	}
+}
+
+func TestWithResponseCacheTrailers(t *testing.T) {
+	var calls int
+	h := withResponseCache(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Write([]byte("unit-test"))
+		w.Header().Set("X-Checksum", strconv.Itoa(calls))
+	}), newMemoryResponseCacheStore(), time.Minute, responseCacheKey())
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	for i := 1; i <= 2; i++ {
+		resp, err := http.Get(server.URL)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if got := resp.Trailer.Get("X-Checksum"); got != strconv.Itoa(i) {
+			t.Errorf("expected trailers to match; got: %q, want: %q", got, strconv.Itoa(i))
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected responses with trailers not to be cached; got: %v calls, want: %v", calls, 2)
+	}
+}
+
+// The proxy streams the chunked responses trailers come with, which keeps
+// them out of the cache on its own
+func TestProxyResponseCacheTrailers(t *testing.T) {
+	var calls int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Write([]byte("unit-test"))
+		w.Header().Set("X-Checksum", strconv.Itoa(calls))
+	}))
+	defer upstream.Close()
+
+	h := handler{
+		l:                   log.NewNopLogger(),
+		optionProxyURL:      upstream.URL,
+		optionProxyCacheTTL: time.Minute,
+	}
+	proxy := httptest.NewServer(newRouter(h, disabledNewRelicApp()))
+	defer proxy.Close()
+
+	for i := 1; i <= 2; i++ {
+		resp, err := http.Get(proxy.URL + "/v1/proxy")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if got := resp.Trailer.Get("X-Checksum"); got != strconv.Itoa(i) {
+			t.Errorf("expected trailers to match; got: %q, want: %q", got, strconv.Itoa(i))
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected responses with trailers not to be cached; got: %v upstream calls, want: %v", calls, 2)
+	}
+}
@@ -0,0 +1,37 @@
+package api
+
+import "io"
+
+// limitedBody reads at most max bytes from r, and then stops as if r had
+// ended. exceeded is set once r turns out to have had more.
+type limitedBody struct {
+	r         io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+func newLimitedBody(r io.Reader, max int64) *limitedBody {
+	return &limitedBody{
+		r:         r,
+		remaining: max,
+	}
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// Peek at one more byte to tell a body that is exactly max long from
+		// one that is too long
+		var one [1]byte
+		if n, _ := b.r.Read(one[:]); n > 0 {
+			b.exceeded = true
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.r.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestLimitedBody(t *testing.T) {
+	type testCase struct {
+		name     string
+		body     string
+		max      int64
+		want     string
+		exceeded bool
+	}
+
+	cases := []testCase{
+		testCase{
+			name: "under the cap",
+			body: "unit",
+			max:  8,
+			want: "unit",
+		},
+		testCase{
+			name: "exactly the cap",
+			body: "unit-tes",
+			max:  8,
+			want: "unit-tes",
+		},
+		testCase{
+			name:     "over the cap",
+			body:     "unit-test",
+			max:      8,
+			want:     "unit-tes",
+			exceeded: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b := newLimitedBody(strings.NewReader(c.body), c.max)
+			got, err := ioutil.ReadAll(b)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			if string(got) != c.want {
+				t.Errorf("expected bodies to match; got: %q, want: %q", got, c.want)
+			}
+			if b.exceeded != c.exceeded {
+				t.Errorf("expected exceeded to match; got: %v, want %v", b.exceeded, c.exceeded)
+			}
+		})
+	}
+}
+
+func TestProxyHandlerMaxResponseBytes(t *testing.T) {
+	type testCase struct {
+		name       string
+		streamed   bool
+		size       int
+		statusCode int
+		bodySize   int
+		warning    string
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "under the cap",
+			size:       512,
+			statusCode: http.StatusOK,
+			bodySize:   512,
+		},
+		testCase{
+			name:       "oversized content length",
+			size:       2048,
+			statusCode: http.StatusBadGateway,
+			warning:    "proxy response is too large",
+		},
+		testCase{
+			name:       "oversized streamed body",
+			streamed:   true,
+			size:       2048,
+			statusCode: http.StatusOK,
+			bodySize:   1024,
+			warning:    "truncated proxy response",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body := bytes.Repeat([]byte("a"), c.size)
+				if c.streamed {
+					// Flushing before the whole body is written leaves the
+					// length unknown
+					w.Write(body[:1])
+					w.(http.Flusher).Flush()
+					w.Write(body[1:])
+					return
+				}
+				w.Write(body)
+			}))
+			defer upstream.Close()
+
+			var logs bytes.Buffer
+			h := handler{
+				l:                           log.NewLogfmtLogger(&logs),
+				optionProxyURL:              upstream.URL,
+				optionProxyMaxResponseBytes: 1024,
+			}
+
+			w := httptest.NewRecorder()
+			h.proxyHandler(w, httptest.NewRequest(http.MethodGet, "/v1/proxy", nil))
+
+			if w.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", w.Code, c.statusCode)
+			}
+			if c.statusCode == http.StatusOK && w.Body.Len() != c.bodySize {
+				t.Errorf("expected body sizes to match; got: %v, want %v", w.Body.Len(), c.bodySize)
+			}
+			if c.warning != "" && !strings.Contains(logs.String(), c.warning) {
+				t.Errorf("expected %q to be logged; got: %s", c.warning, logs.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	newrelic "github.com/newrelic/go-agent"
+	"github.com/rs/cors"
+)
+
+// probePaths are the paths of the probes, which aren't traced.
+var probePaths = []string{"/health", "/ready"}
+
+// streamPaths are the paths that can respond with an event stream rather than
+// JSON, when the upstream sends one.
+var streamPaths = []string{"/v1/proxy"}
+
+func newRouter(h handler, nr newrelic.Application) http.Handler {
+	router := mux.NewRouter()
+	router.NotFoundHandler = http.HandlerFunc(notFoundHandler)
+	router.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowedHandler)
+	if h.slowRequests != nil {
+		router.Use(func(next http.Handler) http.Handler { return withSlowRequests(next, h.slowRequests) })
+	}
+
+	publicRouter := router.PathPrefix("").Subrouter()
+	if h.optionProbeTimeout > 0 {
+		useMiddleware(publicRouter, func(next http.Handler) http.Handler { return withTimeout(next, h.optionProbeTimeout) })
+	}
+	registerPublicRoutes(publicRouter, h)
+
+	// The probes stay reachable over cleartext, since load balancers usually
+	// check them directly rather than through TLS termination
+	protectedRouter := router.PathPrefix("").Subrouter()
+	if h.optionRequireHTTPS {
+		useMiddleware(protectedRouter, func(next http.Handler) http.Handler { return withRequireHTTPS(next, h.optionForwardedProtoHeader) })
+	}
+	useMiddleware(protectedRouter, h.authMiddleware()...)
+	registerProtectedRoutes(protectedRouter, h)
+
+	// Add some middleware
+	var mws []middleware
+	if h.optionVersion != "" {
+		mws = append(mws, func(next http.Handler) http.Handler { return withVersion(next, h.optionVersion) })
+	}
+	mws = append(mws, withTraceContext)
+	if h.optionRequestBudget > 0 {
+		mws = append(mws, func(next http.Handler) http.Handler { return withBudget(next, h.optionRequestBudget) })
+	}
+	mws = append(mws,
+		func(next http.Handler) http.Handler { return withCORS(next, cors.AllowAll()) },
+	)
+	if h.optionRejectUncleanPaths {
+		mws = append(mws, withStrictPath)
+	}
+	mws = append(mws,
+		func(next http.Handler) http.Handler { return withCleanPath(next, h.optionCleanPathRedirect) },
+		skip(newRelicMiddleware(nr), probePaths...),
+	)
+	if h.optionRequireJSONAccept {
+		mws = append(mws, func(next http.Handler) http.Handler { return withRequireJSONAccept(next, streamPaths...) })
+	}
+	return chain(router, mws...)
+}
+
+func registerPublicRoutes(router *mux.Router, h handler) {
+	router.HandleFunc("/health", healthHandler)
+	if h.ready != nil {
+		router.HandleFunc("/ready", h.ready.handler)
+	}
+}
+
+// registerProtectedRoutes registers the routes that require authentication.
+func registerProtectedRoutes(router *mux.Router, h handler) {
+	var proxy http.Handler = http.HandlerFunc(h.proxyHandler)
+	if h.optionProxyCacheTTL > 0 {
+		proxy = withResponseCache(proxy, newMemoryResponseCacheStore(), h.optionProxyCacheTTL, responseCacheKey(h.proxyCacheKeyHeaders()...))
+	}
+	// Cached responses are tagged too, so clients can skip the body of those
+	if h.optionProxyETags {
+		proxy = withETag(proxy)
+	}
+	if len(h.optionProxyRequiredFields) > 0 {
+		proxy = withJSONValidation(proxy, requireFields(h.optionProxyRequiredFields...), h.optionProxyMaxBodyBytes)
+	}
+	if h.optionProxyRequireUTF8JSON {
+		proxy = withUTF8JSON(proxy, h.optionProxyMaxBodyBytes)
+	}
+	if h.optionProxyGunzipRequests {
+		proxy = withGunzip(proxy, h.optionProxyMaxBodyBytes)
+	}
+	if len(h.optionProxyRequiredHeaders) > 0 {
+		proxy = withRequireHeaders(proxy, h.optionProxyRequiredHeaders...)
+	}
+	if h.optionSigningSecret != "" {
+		proxy = withHMACSignature(proxy, h.optionSigningSecret, h.optionSignatureHeader, h.optionSignatureTimestampHeader, h.optionSignatureWindow, h.optionProxyMaxBodyBytes)
+	}
+	// Clients are only rate limited by identities that have been checked
+	if h.optionRateLimit > 0 {
+		proxy = withRateLimit(proxy, newMemoryRateLimitStore(h.optionRateLimit, h.optionRateLimitBurst), rateLimitBySubject)
+	}
+	if len(h.optionWriteKeys) > 0 {
+		proxy = withBasicWriteKey(proxy, writeKeyValidator(h.optionWriteKeys))
+	}
+	if h.optionMaxInFlight > 0 {
+		proxy = withMaxInFlight(proxy, h.optionMaxInFlight, h.optionMaxInFlightQueueTimeout, h.inFlightMetrics)
+	}
+	if h.optionProxyTimeout > 0 {
+		proxy = withTimeout(proxy, h.optionProxyTimeout)
+	}
+	if len(h.optionProxyAllowedMethods) > 0 {
+		proxy = withAllowedMethods(proxy, h.optionProxyAllowedMethods...)
+	}
+	router.Handle("/v1/proxy", proxy)
+}
+
+// authMiddleware returns the middleware that authenticates requests to the
+// protected routes. Nothing is required when there is no verifier.
+func (h handler) authMiddleware() []middleware {
+	if h.verifier == nil {
+		return nil
+	}
+
+	mws := []middleware{
+		func(next http.Handler) http.Handler {
+			return withBearerToken(next, h.optionAuthHeader, h.optionAuthScheme, h.authMetrics)
+		},
+		func(next http.Handler) http.Handler { return withJWT(next, h.verifier, h.l, h.authMetrics) },
+	}
+	if h.optionCertBoundTokens {
+		mws = append(mws, func(next http.Handler) http.Handler { return withCertBinding(next, h.l) })
+	}
+	if h.optionScope != "" {
+		mws = append(mws, func(next http.Handler) http.Handler { return withScope(next, h.optionScope, h.l, h.authMetrics) })
+	}
+	return append(mws, h.authMetrics.withAllowed)
+}
+
+// useMiddleware applies mws to every route on router, so that middleware can be
+// scoped to a group of routes.
+func useMiddleware(router *mux.Router, mws ...middleware) {
+	for _, m := range mws {
+		router.Use(mux.MiddlewareFunc(m))
+	}
+}
@@ -0,0 +1,284 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func do(h handler, method, url string, header http.Header, body interface{}) (*httptest.ResponseRecorder, *http.Request) {
+	testRouter := newRouter(h, disabledNewRelicApp())
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		panic(err)
+	}
+
+	r := httptest.NewRequest(method, url, bytes.NewBuffer(b))
+	r.Header = header
+
+	wr := httptest.NewRecorder()
+
+	testRouter.ServeHTTP(wr, r)
+
+	return wr, r
+}
+
+func TestNewRouterMiddleware(t *testing.T) {
+	h := handler{
+		l: log.NewNopLogger(),
+	}
+
+	header := http.Header{}
+	header.Set("Origin", "https://example.com")
+	wr, _ := do(h, http.MethodGet, "/health", header, nil)
+
+	if got := wr.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("expected cors headers to be set; got: %q, want: %q", got, "*")
+	}
+}
+
+func TestNewRouterCleanPath(t *testing.T) {
+	h := handler{
+		l: log.NewNopLogger(),
+	}
+
+	wr, _ := do(h, http.MethodGet, "/health/", http.Header{}, nil)
+
+	if wr.Code != http.StatusOK {
+		t.Errorf("expected trailing slash to be routed; got: %v, want: %v", wr.Code, http.StatusOK)
+	}
+}
+
+func TestNewRouterRequireJSONAccept(t *testing.T) {
+	h := handler{
+		l:                       log.NewNopLogger(),
+		optionRequireJSONAccept: true,
+	}
+
+	header := http.Header{}
+	header.Set("Accept", "text/html")
+	wr, _ := do(h, http.MethodGet, "/health", header, nil)
+
+	if wr.Code != http.StatusNotAcceptable {
+		t.Errorf("expected html only requests to be rejected; got: %v, want: %v", wr.Code, http.StatusNotAcceptable)
+	}
+}
+
+func TestNewRouterRequireHTTPS(t *testing.T) {
+	h := handler{
+		l:                          log.NewNopLogger(),
+		optionRequireHTTPS:         true,
+		optionForwardedProtoHeader: "X-Forwarded-Proto",
+	}
+
+	header := http.Header{}
+	header.Set("X-Forwarded-Proto", "http")
+
+	if wr, _ := do(h, http.MethodGet, "/health", header, nil); wr.Code != http.StatusOK {
+		t.Errorf("expected health checks over cleartext to be allowed; got: %v, want: %v", wr.Code, http.StatusOK)
+	}
+	if wr, _ := do(h, http.MethodPost, "/v1/proxy", header, nil); wr.Code != http.StatusBadRequest {
+		t.Errorf("expected proxy requests over cleartext to be rejected; got: %v, want: %v", wr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestNewRouterProbesBypassAuth(t *testing.T) {
+	h := handler{
+		l:           log.NewNopLogger(),
+		ready:       NewReadiness(),
+		optionScope: "write:proxy",
+		verifier:    fakeVerifier{},
+	}
+
+	for _, url := range probePaths {
+		if wr, _ := do(h, http.MethodGet, url, http.Header{}, nil); wr.Code != http.StatusOK {
+			t.Errorf("expected %s to be served without a token; got: %v, want: %v", url, wr.Code, http.StatusOK)
+		}
+	}
+	if wr, _ := do(h, http.MethodPost, "/v1/proxy", http.Header{}, nil); wr.Code != http.StatusUnauthorized {
+		t.Errorf("expected proxy requests without a token to be rejected; got: %v, want: %v", wr.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestNewRouterRejectUncleanPaths(t *testing.T) {
+	h := handler{
+		l:                        log.NewNopLogger(),
+		optionRejectUncleanPaths: true,
+	}
+
+	for _, url := range []string{"/v1/../v1/proxy", "/v1/%2e%2e/v1/proxy", "//v1/proxy"} {
+		if wr, _ := do(h, http.MethodPost, url, http.Header{}, nil); wr.Code != http.StatusBadRequest {
+			t.Errorf("expected %s to be rejected; got: %v, want: %v", url, wr.Code, http.StatusBadRequest)
+		}
+	}
+	if wr, _ := do(h, http.MethodGet, "/health/", http.Header{}, nil); wr.Code != http.StatusOK {
+		t.Errorf("expected trailing slashes to still be cleaned; got: %v, want: %v", wr.Code, http.StatusOK)
+	}
+}
+
+func TestNewRouterErrors(t *testing.T) {
+	type testCase struct {
+		name       string
+		method     string
+		url        string
+		header     map[string]string
+		statusCode int
+		code       string
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "not found",
+			method:     http.MethodGet,
+			url:        "/missing",
+			statusCode: http.StatusNotFound,
+			code:       "not_found",
+		},
+		testCase{
+			name:       "missing token",
+			method:     http.MethodPost,
+			url:        "/v1/proxy",
+			statusCode: http.StatusUnauthorized,
+			code:       "unauthorized",
+		},
+		testCase{
+			name:       "missing scope",
+			method:     http.MethodPost,
+			url:        "/v1/proxy",
+			header:     map[string]string{"Authorization": "Bearer unscoped-token"},
+			statusCode: http.StatusForbidden,
+			code:       "forbidden",
+		},
+		testCase{
+			name:       "not acceptable",
+			method:     http.MethodGet,
+			url:        "/health",
+			header:     map[string]string{"Accept": "text/html"},
+			statusCode: http.StatusNotAcceptable,
+			code:       "not_acceptable",
+		},
+	}
+
+	h := handler{
+		l:                       log.NewNopLogger(),
+		optionScope:             "write:proxy",
+		optionRequireJSONAccept: true,
+		verifier: fakeVerifier{
+			"unscoped-token": newTestToken("unscoped-token", "unit-test", "read:proxy"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range c.header {
+				header.Set(k, v)
+			}
+			wr, _ := do(h, c.method, c.url, header, nil)
+
+			if wr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", wr.Code, c.statusCode)
+			}
+			if got := wr.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("expected content types to match; got: %q, want: %q", got, "application/json")
+			}
+
+			var resp apiError
+			if err := json.NewDecoder(wr.Body).Decode(&resp); err != nil {
+				t.Fatal(err.Error())
+			}
+			if resp.Code != c.code {
+				t.Errorf("expected codes to match; got: %q, want: %q", resp.Code, c.code)
+			}
+			if resp.Message == "" || len(resp.RequestID) != 32 {
+				t.Errorf("expected a message and request ID; got: %+v", resp)
+			}
+		})
+	}
+}
+
+func TestNewRouterPreflight(t *testing.T) {
+	h := handler{
+		l:        log.NewNopLogger(),
+		verifier: fakeVerifier{},
+	}
+
+	header := http.Header{}
+	header.Set("Origin", "https://example.com")
+	header.Set("Access-Control-Request-Method", http.MethodPost)
+	header.Set("Access-Control-Request-Headers", "Authorization")
+	wr, _ := do(h, http.MethodOptions, "/v1/proxy", header, nil)
+
+	if wr.Code != http.StatusNoContent {
+		t.Errorf("expected preflight to skip auth; got: %v, want: %v", wr.Code, http.StatusNoContent)
+	}
+	if got := wr.Header().Get("Access-Control-Allow-Methods"); got != http.MethodPost {
+		t.Errorf("expected cors headers to be set; got: %q, want: %q", got, http.MethodPost)
+	}
+}
+
+func TestNewRouterProtectedRoutes(t *testing.T) {
+	type testCase struct {
+		name       string
+		url        string
+		token      string
+		statusCode int
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "public route without a token",
+			url:        "/health",
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "protected route without a token",
+			url:        "/v1/proxy",
+			statusCode: http.StatusUnauthorized,
+		},
+		testCase{
+			name:       "protected route without the scope",
+			url:        "/v1/proxy",
+			token:      "unscoped-token",
+			statusCode: http.StatusForbidden,
+		},
+		testCase{
+			name:       "protected route with a valid token",
+			url:        "/v1/proxy",
+			token:      "valid-token",
+			statusCode: http.StatusOK,
+		},
+	}
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	h := handler{
+		l:              log.NewNopLogger(),
+		optionProxyURL: upstream.URL,
+		optionScope:    "write:proxy",
+		verifier: fakeVerifier{
+			"unscoped-token": newTestToken("unscoped-token", "unit-test", "read:proxy"),
+			"valid-token":    newTestToken("valid-token", "unit-test", "write:proxy"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			header := http.Header{}
+			if c.token != "" {
+				header.Set("Authorization", "Bearer "+c.token)
+			}
+			wr, _ := do(h, http.MethodPost, c.url, header, nil)
+
+			if wr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", wr.Code, c.statusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// writeSelfSignedCert writes a self signed certificate for 127.0.0.1, and its
+// key, to PEM files in dir named after name.
+func writeSelfSignedCert(t *testing.T, dir, name string) (certFile, keyFile string, cert tls.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	certFile = filepath.Join(dir, name+".pem")
+	keyFile = filepath.Join(dir, name+"-key.pem")
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	cert, err = tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return certFile, keyFile, cert
+}
+
+func TestServeCertBoundTokens(t *testing.T) {
+	type testCase struct {
+		name       string
+		clientCert string
+		clientCA   bool
+		statusCode int
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "bound certificate",
+			clientCert: "client",
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "other certificate",
+			clientCert: "other",
+			statusCode: http.StatusUnauthorized,
+		},
+		testCase{
+			name:       "no certificate",
+			statusCode: http.StatusUnauthorized,
+		},
+		testCase{
+			name:       "bound certificate signed by the client ca",
+			clientCert: "client",
+			clientCA:   true,
+			statusCode: http.StatusOK,
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "server-tls")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	serverCertFile, serverKeyFile, _ := writeSelfSignedCert(t, dir, "server")
+	clientCertFile, _, clientCert := writeSelfSignedCert(t, dir, "client")
+	_, _, otherCert := writeSelfSignedCert(t, dir, "other")
+	certs := map[string]tls.Certificate{"client": clientCert, "other": otherCert}
+
+	// The token is bound to the client certificate
+	sum := sha256.Sum256(clientCert.Certificate[0])
+	raw := "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(`{"cnf":{"x5t#S256":"`+base64.RawURLEncoding.EncodeToString(sum[:])+`"}}`)) + ".c2lnbmF0dXJl"
+	h := handler{
+		l:                     log.NewNopLogger(),
+		verifier:              fakeVerifier{"valid-token": newTestToken(raw, "unit-test", "")},
+		optionCertBoundTokens: true,
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// The client certificate is self signed, so it is its own CA
+			var caFile string
+			if c.clientCA {
+				caFile = clientCertFile
+			}
+			tlsConfig, err := LoadServerTLSConfig(serverCertFile, serverKeyFile, caFile)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			server := httptest.NewUnstartedServer(chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), h.authMiddleware()...))
+			server.TLS = tlsConfig
+			server.StartTLS()
+			defer server.Close()
+
+			clientTLS := &tls.Config{InsecureSkipVerify: true}
+			if c.clientCert != "" {
+				clientTLS.Certificates = []tls.Certificate{certs[c.clientCert]}
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+
+			r, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+			r.Header.Set("Authorization", "Bearer valid-token")
+			resp, err := client.Do(r)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", resp.StatusCode, c.statusCode)
+			}
+		})
+	}
+}
+
+func TestLoadServerTLSConfigErrors(t *testing.T) {
+	type testCase struct {
+		name string
+		cert bool
+		key  bool
+	}
+
+	cases := []testCase{
+		testCase{
+			name: "certificate without a key",
+			cert: true,
+		},
+		testCase{
+			name: "client ca without a certificate",
+		},
+		testCase{
+			name: "no certificates in client ca",
+			cert: true,
+			key:  true,
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "server-tls")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile, _ := writeSelfSignedCert(t, dir, "server")
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, []byte("unit-test"), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var cert, key, ca string
+			if c.cert {
+				cert = certFile
+			}
+			if c.key {
+				key = keyFile
+			}
+			if !c.cert || c.key {
+				ca = caFile
+			}
+
+			if _, err := LoadServerTLSConfig(cert, key, ca); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
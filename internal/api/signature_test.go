@@ -0,0 +1,195 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestSignBody(t *testing.T) {
+	// Computed with: printf '1590000000{"event":"unit-test"}' | openssl dgst -sha256 -hmac unit-test
+	want := "23553536c525d9383baec9e7ccedbba5c6bd55d05cf5a0cde6c1ad7e85b3dac7"
+
+	got, err := signBody("unit-test", "1590000000", strings.NewReader(`{"event":"unit-test"}`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if got != want {
+		t.Errorf("expected signatures to match; got: %v, want: %v", got, want)
+	}
+}
+
+func TestProxyHandlerSignature(t *testing.T) {
+	type testCase struct {
+		name            string
+		secret          string
+		header          string
+		timestampHeader string
+		retries         int
+	}
+
+	cases := []testCase{
+		testCase{
+			name: "unsigned",
+		},
+		testCase{
+			name:            "signed",
+			secret:          "unit-test",
+			header:          "X-Signature",
+			timestampHeader: "X-Signature-Timestamp",
+		},
+		testCase{
+			name:            "custom headers",
+			secret:          "unit-test",
+			header:          "X-Hub-Signature",
+			timestampHeader: "X-Hub-Timestamp",
+		},
+		testCase{
+			name:            "signed on every retry",
+			secret:          "unit-test",
+			header:          "X-Signature",
+			timestampHeader: "X-Signature-Timestamp",
+			retries:         1,
+		},
+	}
+
+	body := `{"event":"unit-test"}`
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var attempts int
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				b, _ := ioutil.ReadAll(r.Body)
+
+				signature := r.Header.Get(c.header)
+				timestamp := r.Header.Get(c.timestampHeader)
+				if c.secret == "" {
+					if got := r.Header.Get("X-Signature-Timestamp"); got != "" {
+						t.Errorf("expected the body not to be signed; got timestamp: %q", got)
+					}
+					return
+				}
+
+				mac := hmac.New(sha256.New, []byte(c.secret))
+				mac.Write([]byte(timestamp))
+				mac.Write(b)
+				want := hex.EncodeToString(mac.Sum(nil))
+
+				if timestamp == "" || !hmac.Equal([]byte(signature), []byte(want)) {
+					t.Errorf("expected a verifiable signature; got: %q for timestamp %q, want: %q", signature, timestamp, want)
+				}
+
+				// Fail the first attempt so that the retry is signed too
+				if attempts <= c.retries {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer upstream.Close()
+
+			h := handler{
+				l:                                   log.NewNopLogger(),
+				optionProxyURL:                      upstream.URL,
+				optionProxyRetries:                  c.retries,
+				optionProxyBufferBytes:              1024,
+				optionProxySigningSecret:            c.secret,
+				optionProxySignatureHeader:          c.header,
+				optionProxySignatureTimestampHeader: c.timestampHeader,
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/proxy", strings.NewReader(body))
+			r.Header.Set("X-Signature", "forged")
+			rr := httptest.NewRecorder()
+			h.proxyHandler(rr, r)
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, http.StatusOK)
+			}
+			if attempts != c.retries+1 {
+				t.Errorf("expected attempts to match; got: %v, want: %v", attempts, c.retries+1)
+			}
+		})
+	}
+}
+
+func TestWithHMACSignature(t *testing.T) {
+	type testCase struct {
+		name       string
+		body       string
+		timestamp  time.Time
+		tamper     bool
+		window     time.Duration
+		statusCode int
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "valid",
+			body:       `{"event":"unit-test"}`,
+			timestamp:  time.Now(),
+			window:     5 * time.Minute,
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "tampered",
+			body:       `{"event":"unit-test"}`,
+			timestamp:  time.Now(),
+			tamper:     true,
+			window:     5 * time.Minute,
+			statusCode: http.StatusUnauthorized,
+		},
+		testCase{
+			name:       "stale timestamp",
+			body:       `{"event":"unit-test"}`,
+			timestamp:  time.Now().Add(-10 * time.Minute),
+			window:     5 * time.Minute,
+			statusCode: http.StatusUnauthorized,
+		},
+		testCase{
+			name:       "stale timestamp without a window",
+			body:       `{"event":"unit-test"}`,
+			timestamp:  time.Now().Add(-10 * time.Minute),
+			statusCode: http.StatusOK,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var received string
+			h := withHMACSignature(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := ioutil.ReadAll(r.Body)
+				received = string(b)
+			}), "unit-test", "X-Signature", "X-Signature-Timestamp", c.window, 0)
+
+			timestamp := strconv.FormatInt(c.timestamp.Unix(), 10)
+			signature, _ := signBody("unit-test", timestamp, strings.NewReader(c.body))
+
+			body := c.body
+			if c.tamper {
+				body = `{"event":"tampered"}`
+			}
+			r := httptest.NewRequest(http.MethodPost, "/v1/proxy", strings.NewReader(body))
+			r.Header.Set("X-Signature", signature)
+			r.Header.Set("X-Signature-Timestamp", timestamp)
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.statusCode)
+			}
+			if c.statusCode == http.StatusOK && received != c.body {
+				t.Errorf("expected the body to be passed on; got: %q, want: %q", received, c.body)
+			}
+		})
+	}
+}
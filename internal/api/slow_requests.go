@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// slowRequest is a request kept by SlowRequests.
+type slowRequest struct {
+	Method    string        `json:"method"`
+	Route     string        `json:"route"`
+	Status    int           `json:"status"`
+	RequestID string        `json:"requestId,omitempty"`
+	Start     time.Time     `json:"start"`
+	Duration  time.Duration `json:"-"`
+}
+
+type slowRequestResponse struct {
+	slowRequest
+	Duration string `json:"duration"`
+}
+
+// SlowRequests keeps the slowest requests served, so that they can be looked
+// into without an APM. It never holds more than the size it was created with.
+type SlowRequests struct {
+	mutex    sync.Mutex
+	size     int
+	requests []slowRequest
+}
+
+// NewSlowRequests creates a SlowRequests that keeps the size slowest requests.
+func NewSlowRequests(size int) *SlowRequests {
+	return &SlowRequests{
+		size:     size,
+		requests: make([]slowRequest, 0, size),
+	}
+}
+
+// add keeps req if it is one of the slowest requests seen so far. The requests
+// are kept sorted with the slowest first, so the fastest is dropped when it is
+// full.
+func (s *SlowRequests) add(req slowRequest) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.size <= 0 {
+		return
+	}
+	if len(s.requests) == s.size && req.Duration <= s.requests[len(s.requests)-1].Duration {
+		return
+	}
+
+	i := sort.Search(len(s.requests), func(i int) bool {
+		return s.requests[i].Duration < req.Duration
+	})
+	if len(s.requests) < s.size {
+		s.requests = append(s.requests, slowRequest{})
+	}
+	copy(s.requests[i+1:], s.requests[i:])
+	s.requests[i] = req
+}
+
+// slowest returns a copy of the requests kept, slowest first.
+func (s *SlowRequests) slowest() []slowRequest {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]slowRequest(nil), s.requests...)
+}
+
+// withSlowRequests records the duration of every request in s. It must be
+// used as router middleware so that requests are recorded by their route
+// template rather than their path, and inside withTraceContext so that they
+// carry their trace ID.
+func withSlowRequests(next http.Handler, s *SlowRequests) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		lw := &accessLogResponseWriter{
+			w:      w,
+			status: http.StatusOK,
+		}
+		next.ServeHTTP(lw, r)
+
+		req := slowRequest{
+			Method:   r.Method,
+			Route:    r.URL.Path,
+			Status:   lw.status,
+			Start:    start,
+			Duration: time.Since(start),
+		}
+		if route := mux.CurrentRoute(r); route != nil {
+			if tmpl, err := route.GetPathTemplate(); err == nil {
+				req.Route = tmpl
+			}
+		}
+		if tc, ok := traceContextFromContext(r.Context()); ok {
+			req.RequestID = tc.TraceID
+		}
+		s.add(req)
+	})
+}
+
+// SlowRequestsHandler responds with the requests kept by s, slowest first. It
+// must only be served on the internal metrics server.
+func SlowRequestsHandler(s *SlowRequests) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := []slowRequestResponse{}
+		for _, req := range s.slowest() {
+			resp = append(resp, slowRequestResponse{
+				slowRequest: req,
+				Duration:    req.Duration.String(),
+			})
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(resp)
+	})
+}
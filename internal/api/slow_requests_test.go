@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestSlowRequestsAdd(t *testing.T) {
+	s := NewSlowRequests(3)
+	for _, ms := range []int{5, 1, 9, 3, 7, 2, 8} {
+		s.add(slowRequest{Duration: time.Duration(ms) * time.Millisecond})
+	}
+
+	got := s.slowest()
+	want := []time.Duration{9 * time.Millisecond, 8 * time.Millisecond, 7 * time.Millisecond}
+	if len(got) != len(want) {
+		t.Fatalf("expected number of requests kept to match; got: %v, want %v", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Duration != want[i] {
+			t.Errorf("expected durations to match at %d; got: %v, want %v", i, got[i].Duration, want[i])
+		}
+	}
+}
+
+func TestSlowRequestsConcurrent(t *testing.T) {
+	s := NewSlowRequests(10)
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.add(slowRequest{Duration: time.Duration(i)})
+		}(i)
+	}
+	wg.Wait()
+
+	got := s.slowest()
+	if len(got) != 10 {
+		t.Fatalf("expected number of requests kept to match; got: %v, want %v", len(got), 10)
+	}
+	for i, req := range got {
+		if want := time.Duration(100 - i); req.Duration != want {
+			t.Errorf("expected durations to match at %d; got: %v, want %v", i, req.Duration, want)
+		}
+	}
+}
+
+func TestWithSlowRequests(t *testing.T) {
+	s := NewSlowRequests(1)
+
+	router := mux.NewRouter()
+	router.Use(withTraceContext)
+	router.Use(func(next http.Handler) http.Handler { return withSlowRequests(next, s) })
+	router.HandleFunc("/v1/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["id"] == "slow" {
+			time.Sleep(20 * time.Millisecond)
+			w.WriteHeader(http.StatusAccepted)
+		}
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/items/fast", nil))
+	r := httptest.NewRequest(http.MethodPost, "/v1/items/slow", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/items/fast", nil))
+
+	w := httptest.NewRecorder()
+	SlowRequestsHandler(s).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/slow-requests", nil))
+
+	var resp []map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(resp) != 1 {
+		t.Fatalf("expected only the slowest request to be kept; got: %v", resp)
+	}
+
+	want := map[string]interface{}{
+		"method":    http.MethodPost,
+		"route":     "/v1/items/{id}",
+		"status":    float64(http.StatusAccepted),
+		"requestId": "4bf92f3577b34da6a3ce929d0e0e4736",
+	}
+	for k, v := range want {
+		if resp[0][k] != v {
+			t.Errorf("expected %s to match; got: %v, want %v", k, resp[0][k], v)
+		}
+	}
+	if d, err := time.ParseDuration(resp[0]["duration"].(string)); err != nil || d < 20*time.Millisecond {
+		t.Errorf("expected the duration of the slow request; got: %v", resp[0]["duration"])
+	}
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// withStrictPath responds with a 400 to requests whose path would be changed
+// by cleaning it, other than for a trailing slash: duplicate slashes, . and ..
+// segments, whether they were sent plain or percent encoded, and encoded
+// slashes. Paths like these are only ever sent to reach somewhere other than
+// where they appear to go, so they are refused rather than cleaned. It has to
+// run before withCleanPath, which would hide them.
+func withStrictPath(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isStrictPath(r) {
+			sendError(w, r, http.StatusBadRequest, "the request path must not contain empty, . or .. segments or encoded slashes")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isStrictPath reports whether r's path is made up of plain segments only.
+func isStrictPath(r *http.Request) bool {
+	escaped := strings.ToLower(r.URL.EscapedPath())
+	if strings.Contains(escaped, "%2f") || strings.Contains(escaped, "%5c") {
+		return false
+	}
+
+	p := strings.TrimSuffix(r.URL.Path, "/")
+	if p == "" {
+		return true
+	}
+	for _, segment := range strings.Split(p, "/")[1:] {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithStrictPath(t *testing.T) {
+	type testCase struct {
+		name       string
+		url        string
+		statusCode int
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "clean",
+			url:        "/v1/proxy",
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "root",
+			url:        "/",
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "trailing slash",
+			url:        "/v1/proxy/",
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "dot in a segment",
+			url:        "/v1/proxy.json",
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "traversal",
+			url:        "/v1/../admin",
+			statusCode: http.StatusBadRequest,
+		},
+		testCase{
+			name:       "encoded traversal",
+			url:        "/v1/%2e%2e/admin",
+			statusCode: http.StatusBadRequest,
+		},
+		testCase{
+			name:       "current directory",
+			url:        "/v1/./proxy",
+			statusCode: http.StatusBadRequest,
+		},
+		testCase{
+			name:       "doubled slash",
+			url:        "/v1//proxy",
+			statusCode: http.StatusBadRequest,
+		},
+		testCase{
+			name:       "doubled leading slash",
+			url:        "//v1/proxy",
+			statusCode: http.StatusBadRequest,
+		},
+		testCase{
+			name:       "encoded slash",
+			url:        "/v1%2Fproxy",
+			statusCode: http.StatusBadRequest,
+		},
+		testCase{
+			name:       "encoded backslash",
+			url:        "/v1%5c..%5cadmin",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			forwarded := false
+			h := withStrictPath(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				forwarded = true
+			}))
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, c.url, nil))
+
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.statusCode)
+			}
+			if forwarded != (c.statusCode == http.StatusOK) {
+				t.Errorf("expected the request to be served only when its path is clean; got: %v", forwarded)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// ValidateTenantURL checks that raw is an absolute https URL for an auth
+// tenant, like https://example.auth0.com. A bad tenant URL otherwise only
+// shows up as a failed key fetch the first time a token is verified.
+func ValidateTenantURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("tenant URL %q does not parse: %v", raw, err)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("tenant URL %q must use https", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("tenant URL %q has no host", raw)
+	}
+	if u.Path != "" && u.Path != "/" {
+		return fmt.Errorf("tenant URL %q must not have a path", raw)
+	}
+	if u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return fmt.Errorf("tenant URL %q must only have a scheme and host", raw)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const contextKeyTimeout contextKey = "timeout"
+
+// withTimeout gives every request d to be served in, by putting a deadline on
+// its context, so that routes can have budgets of their own rather than just
+// the server wide timeouts. Handlers have to honor the context for it to take
+// effect, as the proxy and the readiness checks do. Event streams are left
+// alone, since they stay open until either side closes them. Requests that
+// only turn out to be streams once the upstream responds can be let off the
+// deadline with liftTimeout.
+func withTimeout(next http.Handler, d time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isEventStream(r.Header.Get("Accept")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := newTimeoutContext(r.Context(), d)
+		defer ctx.cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// liftTimeout lets the request ctx belongs to off the deadline set by
+// withTimeout, for responses that stream until either side closes them. It
+// reports whether the deadline was lifted, which it can't be once it has
+// passed.
+func liftTimeout(ctx context.Context) bool {
+	tc, ok := ctx.Value(contextKeyTimeout).(*timeoutContext)
+	if !ok {
+		return true
+	}
+	return tc.lift()
+}
+
+// timeoutContext is done with context.DeadlineExceeded once its deadline
+// passes, like a context from context.WithTimeout, except that the deadline
+// can be lifted. It keeps its own done channel rather than deriving one with
+// context.WithCancel, so that contexts derived from it see its own error
+// rather than context.Canceled.
+type timeoutContext struct {
+	context.Context
+	deadline time.Time
+	timer    *time.Timer
+	done     chan struct{}
+
+	mutex  sync.Mutex
+	err    error
+	lifted bool
+}
+
+func newTimeoutContext(parent context.Context, d time.Duration) *timeoutContext {
+	c := &timeoutContext{
+		Context:  parent,
+		deadline: time.Now().Add(d),
+		done:     make(chan struct{}),
+	}
+
+	// Hold the lock so that the timer is set before it can fire
+	c.mutex.Lock()
+	c.timer = time.AfterFunc(d, c.expire)
+	c.mutex.Unlock()
+
+	go func() {
+		select {
+		case <-parent.Done():
+			c.finish(parent.Err())
+		case <-c.done:
+		}
+	}()
+	return c
+}
+
+func (c *timeoutContext) Deadline() (time.Time, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	parent, ok := c.Context.Deadline()
+	if c.lifted || (ok && parent.Before(c.deadline)) {
+		return parent, ok
+	}
+	return c.deadline, true
+}
+
+func (c *timeoutContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *timeoutContext) Err() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+func (c *timeoutContext) Value(key interface{}) interface{} {
+	if key == contextKeyTimeout {
+		return c
+	}
+	return c.Context.Value(key)
+}
+
+// cancel releases the context once the request has been served.
+func (c *timeoutContext) cancel() {
+	c.finish(context.Canceled)
+}
+
+func (c *timeoutContext) expire() {
+	c.mutex.Lock()
+	lifted := c.lifted
+	c.mutex.Unlock()
+
+	if !lifted {
+		c.finish(context.DeadlineExceeded)
+	}
+}
+
+func (c *timeoutContext) finish(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	c.timer.Stop()
+	close(c.done)
+}
+
+func (c *timeoutContext) lift() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.err != nil {
+		return false
+	}
+	c.lifted = true
+	c.timer.Stop()
+	return true
+}
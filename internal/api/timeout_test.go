@@ -0,0 +1,166 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestWithTimeout(t *testing.T) {
+	type testCase struct {
+		name        string
+		accept      string
+		hasDeadline bool
+	}
+
+	cases := []testCase{
+		testCase{
+			name:        "request",
+			hasDeadline: true,
+		},
+		testCase{
+			name:   "event stream",
+			accept: "text/event-stream",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var hasDeadline bool
+			h := withTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, hasDeadline = r.Context().Deadline()
+			}), time.Second)
+
+			r := httptest.NewRequest(http.MethodGet, "/v1/proxy", nil)
+			if c.accept != "" {
+				r.Header.Set("Accept", c.accept)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if hasDeadline != c.hasDeadline {
+				t.Errorf("expected deadline to match; got: %v, want %v", hasDeadline, c.hasDeadline)
+			}
+		})
+	}
+}
+
+func TestLiftTimeout(t *testing.T) {
+	const timeout = 20 * time.Millisecond
+
+	ctx := newTimeoutContext(context.Background(), timeout)
+	defer ctx.cancel()
+	if !liftTimeout(ctx) {
+		t.Fatal("expected the deadline to be lifted")
+	}
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("expected no deadline once lifted")
+	}
+
+	select {
+	case <-ctx.Done():
+		t.Errorf("expected the context to outlive its deadline; got: %v", ctx.Err())
+	case <-time.After(2 * timeout):
+	}
+
+	expired := newTimeoutContext(context.Background(), timeout)
+	defer expired.cancel()
+	<-expired.Done()
+	if err := expired.Err(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected errors to match; got: %v, want %v", err, context.DeadlineExceeded)
+	}
+	if liftTimeout(expired) {
+		t.Error("expected a passed deadline not to be lifted")
+	}
+}
+
+func TestNewRouterTimeoutsEventStream(t *testing.T) {
+	// The upstream takes several times the route's timeout to send every
+	// event, and the caller doesn't ask for an event stream up front
+	const (
+		events  = 8
+		timeout = 50 * time.Millisecond
+	)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+
+		for i := 0; i < events; i++ {
+			fmt.Fprintf(w, "data: event %d\n\n", i)
+			w.(http.Flusher).Flush()
+			time.Sleep(timeout / 2)
+		}
+	}))
+	defer upstream.Close()
+
+	h := handler{
+		l:                  log.NewNopLogger(),
+		optionProxyURL:     upstream.URL,
+		optionProxyTimeout: timeout,
+	}
+	proxy := httptest.NewServer(newRouter(h, disabledNewRelicApp()))
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/v1/proxy")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer resp.Body.Close()
+
+	var got int
+	lines := bufio.NewScanner(resp.Body)
+	for lines.Scan() {
+		if lines.Text() != "" {
+			got++
+		}
+	}
+	if got != events {
+		t.Errorf("expected every event to arrive; got: %v, want %v", got, events)
+	}
+}
+
+func TestNewRouterTimeouts(t *testing.T) {
+	// The proxy's delay is longer than any timeout on the proxy client, so
+	// that only the route's own timeout applies
+	const (
+		proxyDelay = 6 * time.Second
+		probeDelay = 50 * time.Millisecond
+	)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(proxyDelay)
+	}))
+	defer upstream.Close()
+
+	ready := NewReadiness()
+	ready.Register("slow", time.Second, func(ctx context.Context) error {
+		select {
+		case <-time.After(probeDelay):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	h := handler{
+		l:                  log.NewNopLogger(),
+		ready:              ready,
+		optionProxyURL:     upstream.URL,
+		optionProxyTimeout: 30 * time.Second,
+		optionProbeTimeout: probeDelay / 5,
+	}
+
+	if wr, _ := do(h, http.MethodPost, "/v1/proxy", http.Header{}, nil); wr.Code != http.StatusOK {
+		t.Errorf("expected the proxy to tolerate the delay; got: %v, want %v", wr.Code, http.StatusOK)
+	}
+	if wr, _ := do(h, http.MethodGet, "/ready", http.Header{}, nil); wr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected the probe to time out; got: %v, want %v", wr.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	rvAuth "github.com/RedVentures/sdk-go/auth"
+)
+
+type cachedToken struct {
+	token   *rvAuth.Token
+	expires time.Time
+}
+
+// TokenCache is a Verifier that remembers the tokens verified by another for
+// a short while, so that a client presenting the same token to many endpoints
+// at once, like a single page app making parallel calls, only has it verified
+// the first time. Tokens are never remembered past their expiry, and tokens
+// that fail verification aren't remembered at all.
+type TokenCache struct {
+	verifier Verifier
+	ttl      time.Duration
+	now      func() time.Time
+
+	mutex     sync.Mutex
+	tokens    map[[sha256.Size]byte]cachedToken
+	lastSweep time.Time
+}
+
+// NewTokenCache creates a cache that remembers the tokens verified by v for up
+// to ttl.
+func NewTokenCache(v Verifier, ttl time.Duration) *TokenCache {
+	return &TokenCache{
+		verifier: v,
+		ttl:      ttl,
+		now:      time.Now,
+		tokens:   make(map[[sha256.Size]byte]cachedToken),
+	}
+}
+
+// VerifyToken returns the token remembered for raw, or has it verified and
+// remembers it when there is none. Tokens are keyed by their hash, so that
+// they aren't kept around in the clear.
+func (c *TokenCache) VerifyToken(raw string) (*rvAuth.Token, error) {
+	key := sha256.Sum256([]byte(raw))
+
+	c.mutex.Lock()
+	now := c.now()
+	c.sweep(now)
+	cached, ok := c.tokens[key]
+	c.mutex.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.token, nil
+	}
+
+	token, err := c.verifier.VerifyToken(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	expires := now.Add(c.ttl)
+	if token.Claims != nil && token.Claims.ExpiresAt != 0 {
+		if exp := time.Unix(token.Claims.ExpiresAt, 0); exp.Before(expires) {
+			expires = exp
+		}
+	}
+	if expires.After(now) {
+		c.mutex.Lock()
+		// RawClaims fills in the token the first time it is called, so it is
+		// called before the token is shared for callers to only ever read it.
+		// Tokens whose claims can't be read are never shared
+		if _, err := token.RawClaims(); err == nil {
+			c.tokens[key] = cachedToken{token: token, expires: expires}
+		}
+		c.mutex.Unlock()
+	}
+
+	return token, nil
+}
+
+// ResetCache forgets every token, such as after the keys they were signed
+// with have been revoked.
+func (c *TokenCache) ResetCache() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.tokens = make(map[[sha256.Size]byte]cachedToken)
+}
+
+// sweep drops the tokens that have expired, once a minute so that it doesn't
+// slow down every verification. It must be called with the mutex held.
+func (c *TokenCache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < time.Minute {
+		return
+	}
+	c.lastSweep = now
+
+	for key, cached := range c.tokens {
+		if !now.Before(cached.expires) {
+			delete(c.tokens, key)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	rvAuth "github.com/RedVentures/sdk-go/auth"
+)
+
+// countingVerifier counts the tokens passed on to the Verifier it wraps.
+type countingVerifier struct {
+	Verifier
+	calls int
+}
+
+func (v *countingVerifier) VerifyToken(raw string) (*rvAuth.Token, error) {
+	v.calls++
+	return v.Verifier.VerifyToken(raw)
+}
+
+func TestTokenCache(t *testing.T) {
+	type testCase struct {
+		name    string
+		token   string
+		expires time.Duration
+		elapsed time.Duration
+		calls   int
+	}
+
+	valid := issuedToken("https://unit-test.auth0.com/")
+
+	cases := []testCase{
+		testCase{
+			name:    "within the window",
+			token:   valid,
+			expires: time.Hour,
+			elapsed: 30 * time.Second,
+			calls:   1,
+		},
+		testCase{
+			name:    "after the window",
+			token:   valid,
+			expires: time.Hour,
+			elapsed: time.Minute,
+			calls:   2,
+		},
+		testCase{
+			name:    "after the token expires",
+			token:   valid,
+			expires: 10 * time.Second,
+			elapsed: 10 * time.Second,
+			calls:   2,
+		},
+		testCase{
+			name:    "already expired",
+			token:   valid,
+			expires: -time.Second,
+			calls:   2,
+		},
+		testCase{
+			name:  "invalid token",
+			token: "invalid-token",
+			calls: 2,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			now := time.Now()
+			token := newTestToken(valid, "unit-test", "")
+			token.Claims.ExpiresAt = now.Add(c.expires).Unix()
+
+			v := &countingVerifier{Verifier: fakeVerifier{valid: token}}
+			cache := NewTokenCache(v, time.Minute)
+			cache.now = func() time.Time { return now }
+
+			first, firstErr := cache.VerifyToken(c.token)
+			now = now.Add(c.elapsed)
+			second, secondErr := cache.VerifyToken(c.token)
+
+			if v.calls != c.calls {
+				t.Errorf("expected verifications to match; got: %v, want %v", v.calls, c.calls)
+			}
+			if first != second || (firstErr == nil) != (secondErr == nil) {
+				t.Errorf("expected the same result twice; got: %v, %v then: %v, %v", first, firstErr, second, secondErr)
+			}
+		})
+	}
+}
+
+func TestTokenCacheReset(t *testing.T) {
+	valid := issuedToken("https://unit-test.auth0.com/")
+	v := &countingVerifier{Verifier: fakeVerifier{valid: newTestToken(valid, "unit-test", "")}}
+	cache := NewTokenCache(v, time.Minute)
+
+	cache.VerifyToken(valid)
+	cache.ResetCache()
+	cache.VerifyToken(valid)
+
+	if v.calls != 2 {
+		t.Errorf("expected the token to be verified again; got: %v, want %v", v.calls, 2)
+	}
+}
+
+func TestTokenCacheUnreadableClaims(t *testing.T) {
+	v := &countingVerifier{Verifier: fakeVerifier{"valid-token": newTestToken("valid-token", "unit-test", "")}}
+	cache := NewTokenCache(v, time.Minute)
+
+	cache.VerifyToken("valid-token")
+	cache.VerifyToken("valid-token")
+
+	if v.calls != 2 {
+		t.Errorf("expected a token without readable claims not to be cached; got: %v verifications, want %v", v.calls, 2)
+	}
+}
+
+// TestTokenCacheConcurrentClaims is meant to be run with -race, which reports
+// callers sharing a cached token while its claims are still being filled in.
+func TestTokenCacheConcurrentClaims(t *testing.T) {
+	valid := issuedToken("https://unit-test.auth0.com/")
+	cache := NewTokenCache(fakeVerifier{valid: newTestToken(valid, "unit-test", "")}, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := cache.VerifyToken(valid)
+			if err != nil {
+				t.Error(err.Error())
+				return
+			}
+			if claims, err := token.RawClaims(); err != nil || claims["iss"] != "https://unit-test.auth0.com/" {
+				t.Errorf("expected the token's claims; got: %v, %v", claims, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// rsaVerifier checks an RSA signature of every token, standing in for the
+// signature check rvAuth.Verifier does.
+type rsaVerifier struct {
+	key       *rsa.PublicKey
+	signature []byte
+}
+
+func (v rsaVerifier) VerifyToken(raw string) (*rvAuth.Token, error) {
+	sum := sha256.Sum256([]byte(raw))
+	if err := rsa.VerifyPKCS1v15(v.key, crypto.SHA256, sum[:], v.signature); err != nil {
+		return nil, errors.New("unit-test: invalid signature")
+	}
+	return newTestToken(raw, "unit-test", ""), nil
+}
+
+func BenchmarkTokenCache(b *testing.B) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		b.Fatal(err.Error())
+	}
+	valid := issuedToken("https://unit-test.auth0.com/")
+	sum := sha256.Sum256([]byte(valid))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		b.Fatal(err.Error())
+	}
+	v := rsaVerifier{key: &key.PublicKey, signature: signature}
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			v.VerifyToken(valid)
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		cache := NewTokenCache(v, time.Minute)
+		for i := 0; i < b.N; i++ {
+			cache.VerifyToken(valid)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+type contextKey string
+
+const contextKeyTraceContext contextKey = "trace-context"
+
+// traceparentPattern matches a version 00 W3C traceparent header. See
+// https://www.w3.org/TR/trace-context/#traceparent-header.
+var traceparentPattern = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+// traceContext is the W3C trace context for the current request.
+type traceContext struct {
+	// TraceID identifies the whole trace across every service.
+	TraceID string
+
+	// ParentID is the span ID of the caller, it is empty when we started the
+	// trace.
+	ParentID string
+
+	// SpanID identifies the work done by this service.
+	SpanID string
+
+	// Flags are the trace flags, such as whether the trace is sampled.
+	Flags string
+
+	// State is the vendor specific tracestate header, passed on untouched.
+	State string
+}
+
+// traceparent formats the trace context as a traceparent header with this
+// service's span as the parent.
+func (tc traceContext) traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%s", tc.TraceID, tc.SpanID, tc.Flags)
+}
+
+// traceContextFromContext returns the trace context stored by
+// withTraceContext.
+func traceContextFromContext(ctx context.Context) (traceContext, bool) {
+	tc, ok := ctx.Value(contextKeyTraceContext).(traceContext)
+	return tc, ok
+}
+
+// withTraceContext reads the traceparent and tracestate headers from the
+// request, starting a new trace when they are missing or invalid, and stores
+// them in the request context. The traceparent for this service's span is
+// echoed back on the response.
+func withTraceContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tc := traceContext{
+			SpanID: newTraceID(8),
+			Flags:  "01",
+		}
+
+		if m := traceparentPattern.FindStringSubmatch(r.Header.Get("traceparent")); m != nil && !allZero(m[1]) && !allZero(m[2]) {
+			tc.TraceID = m[1]
+			tc.ParentID = m[2]
+			tc.Flags = m[3]
+			tc.State = r.Header.Get("tracestate")
+		} else {
+			tc.TraceID = newTraceID(16)
+		}
+
+		w.Header().Set("traceparent", tc.traceparent())
+
+		ctx := context.WithValue(r.Context(), contextKeyTraceContext, tc)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// newTraceID returns n random bytes as lowercase hex.
+func newTraceID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func allZero(id string) bool {
+	for _, c := range id {
+		if c != '0' {
+			return false
+		}
+	}
+	return true
+}
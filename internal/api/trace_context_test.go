@@ -0,0 +1,126 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestWithTraceContext(t *testing.T) {
+	type testCase struct {
+		name        string
+		traceparent string
+		tracestate  string
+		traceID     string
+		parentID    string
+		state       string
+	}
+
+	cases := []testCase{
+		testCase{
+			name:        "pass through",
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			tracestate:  "rojo=00f067aa0ba902b7",
+			traceID:     "4bf92f3577b34da6a3ce929d0e0e4736",
+			parentID:    "00f067aa0ba902b7",
+			state:       "rojo=00f067aa0ba902b7",
+		},
+		testCase{
+			name: "generated when missing",
+		},
+		testCase{
+			name:        "generated when invalid",
+			traceparent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			tracestate:  "rojo=00f067aa0ba902b7",
+		},
+	}
+
+	traceparent := regexp.MustCompile(`^00-[0-9a-f]{32}-[0-9a-f]{16}-[0-9a-f]{2}$`)
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var tc traceContext
+			h := withTraceContext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tc, _ = traceContextFromContext(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/proxy", nil)
+			if c.traceparent != "" {
+				r.Header.Set("traceparent", c.traceparent)
+				r.Header.Set("tracestate", c.tracestate)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			if c.traceID != "" && tc.TraceID != c.traceID {
+				t.Errorf("expected trace ids to match; got: %v, want: %v", tc.TraceID, c.traceID)
+			}
+			if c.traceID == "" && len(tc.TraceID) != 32 {
+				t.Errorf("expected a generated trace id; got: %q", tc.TraceID)
+			}
+			if tc.ParentID != c.parentID {
+				t.Errorf("expected parent ids to match; got: %v, want: %v", tc.ParentID, c.parentID)
+			}
+			if tc.State != c.state {
+				t.Errorf("expected trace states to match; got: %v, want: %v", tc.State, c.state)
+			}
+			if got := rr.Header().Get("traceparent"); got != tc.traceparent() || !traceparent.MatchString(got) {
+				t.Errorf("expected response traceparent for our span; got: %v, want: %v", got, tc.traceparent())
+			}
+		})
+	}
+}
+
+func TestProxyHandlerTraceContext(t *testing.T) {
+	var upstreamHeader http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHeader = r.Header
+	}))
+	defer upstream.Close()
+
+	h := handler{
+		l:              log.NewNopLogger(),
+		optionProxyURL: upstream.URL,
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/proxy", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.Header.Set("tracestate", "rojo=00f067aa0ba902b7")
+	rr := httptest.NewRecorder()
+	withTraceContext(http.HandlerFunc(h.proxyHandler)).ServeHTTP(rr, r)
+
+	if got, want := upstreamHeader["Traceparent"], []string{rr.Header().Get("traceparent")}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("expected upstream traceparent to be our span; got: %v, want: %v", got, want)
+	}
+	if got := upstreamHeader.Get("tracestate"); got != "rojo=00f067aa0ba902b7" {
+		t.Errorf("expected upstream tracestate to be passed through; got: %v", got)
+	}
+}
+
+func TestTraceContextRequestIDHeaders(t *testing.T) {
+	var upstreamHeader http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHeader = r.Header
+	}))
+	defer upstream.Close()
+
+	h := handler{
+		l:                           log.NewNopLogger(),
+		optionProxyURL:              upstream.URL,
+		optionProxyRequestIDHeaders: []string{"X-Request-ID", "X-Correlation-ID", "Request-Id"},
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/proxy", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.Header.Set("X-Request-ID", "spoofed")
+	withTraceContext(http.HandlerFunc(h.proxyHandler)).ServeHTTP(httptest.NewRecorder(), r)
+
+	for _, header := range h.optionProxyRequestIDHeaders {
+		if got := upstreamHeader[http.CanonicalHeaderKey(header)]; len(got) != 1 || got[0] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("expected %s to carry the trace ID; got: %v", header, got)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// RequestTransform reshapes the request to the upstream before it is sent,
+// such as renaming a field in the body or adding a header. Headers it sets
+// are sent as they are, they aren't subject to the header allow or deny lists.
+type RequestTransform func(*http.Request) error
+
+// ResponseTransform reshapes the response from the upstream before it is
+// written back to the client.
+type ResponseTransform func(*http.Response) error
+
+// SetRequestBody replaces the body of r with b, keeping its length in step so
+// that the request isn't sent with the length of the old body.
+func SetRequestBody(r *http.Request, b []byte) {
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	r.ContentLength = int64(len(b))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+}
+
+// SetResponseBody replaces the body of resp with b, keeping its length in step
+// so that the client isn't sent the length of the old body. The old body is
+// closed.
+func SetResponseBody(resp *http.Response, b []byte) {
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+	resp.ContentLength = int64(len(b))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(b)))
+}
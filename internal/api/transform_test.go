@@ -0,0 +1,158 @@
+package api
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestProxyHandlerTransforms(t *testing.T) {
+	type testCase struct {
+		name              string
+		retries           int
+		requestTransform  RequestTransform
+		responseTransform ResponseTransform
+		statusCode        int
+		upstreamBody      string
+		upstreamHeader    string
+		body              string
+	}
+
+	renameField := func(r *http.Request) error {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		SetRequestBody(r, []byte(strings.Replace(string(b), `"event"`, `"eventName"`, 1)))
+		r.Header.Set("X-Transformed", "unit-test")
+		return nil
+	}
+
+	cases := []testCase{
+		testCase{
+			name:         "no transforms",
+			statusCode:   http.StatusOK,
+			upstreamBody: `{"event":"unit-test"}`,
+			body:         `{"status":"ok"}`,
+		},
+		testCase{
+			name:             "request transform",
+			requestTransform: renameField,
+			statusCode:       http.StatusOK,
+			upstreamBody:     `{"eventName":"unit-test"}`,
+			upstreamHeader:   "unit-test",
+			body:             `{"status":"ok"}`,
+		},
+		testCase{
+			name:             "request transform with retries",
+			retries:          1,
+			requestTransform: renameField,
+			statusCode:       http.StatusOK,
+			upstreamBody:     `{"eventName":"unit-test"}`,
+			upstreamHeader:   "unit-test",
+			body:             `{"status":"ok"}`,
+		},
+		testCase{
+			name: "response transform",
+			responseTransform: func(resp *http.Response) error {
+				b, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					return err
+				}
+				SetResponseBody(resp, []byte(strings.Replace(string(b), `"ok"`, `"accepted"`, 1)))
+				return nil
+			},
+			statusCode:   http.StatusOK,
+			upstreamBody: `{"event":"unit-test"}`,
+			body:         `{"status":"accepted"}`,
+		},
+		testCase{
+			name: "request transform error",
+			requestTransform: func(r *http.Request) error {
+				return errors.New("unit-test")
+			},
+			statusCode: http.StatusInternalServerError,
+			body:       `{"code":"internal_server_error","message":"could not transform proxy request: unit-test"}`,
+		},
+		testCase{
+			name: "response transform error",
+			responseTransform: func(resp *http.Response) error {
+				return errors.New("unit-test")
+			},
+			statusCode:   http.StatusInternalServerError,
+			upstreamBody: `{"event":"unit-test"}`,
+			body:         `{"code":"internal_server_error","message":"could not transform proxy response: unit-test"}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var (
+				upstreamBody   string
+				upstreamHeader string
+				attempts       int
+			)
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				b, _ := ioutil.ReadAll(r.Body)
+				upstreamBody = string(b)
+				upstreamHeader = r.Header.Get("X-Transformed")
+
+				// Bodies that aren't buffered are streamed without a length
+				if r.ContentLength != -1 && r.ContentLength != int64(len(b)) {
+					t.Errorf("expected the content length to match the body; got: %v, want: %v", r.ContentLength, len(b))
+				}
+
+				// Fail the first attempt so that the transformed body is replayed
+				if attempts <= c.retries {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.Header().Set("Content-Length", strconv.Itoa(len(`{"status":"ok"}`)))
+				w.Write([]byte(`{"status":"ok"}`))
+			}))
+			defer upstream.Close()
+
+			h := handler{
+				l:                      log.NewNopLogger(),
+				optionProxyURL:         upstream.URL,
+				optionProxyRetries:     c.retries,
+				optionProxyBufferBytes: 1024,
+				requestTransform:       c.requestTransform,
+				responseTransform:      c.responseTransform,
+			}
+			proxy := httptest.NewServer(http.HandlerFunc(h.proxyHandler))
+			defer proxy.Close()
+
+			resp, err := http.Post(proxy.URL, "application/json", strings.NewReader(`{"event":"unit-test"}`))
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			defer resp.Body.Close()
+
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			if resp.StatusCode != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", resp.StatusCode, c.statusCode)
+			}
+			if got := strings.TrimSpace(string(body)); got != c.body {
+				t.Errorf("expected bodies to match; got: %q, want: %q", got, c.body)
+			}
+			if upstreamBody != c.upstreamBody {
+				t.Errorf("expected upstream bodies to match; got: %q, want: %q", upstreamBody, c.upstreamBody)
+			}
+			if upstreamHeader != c.upstreamHeader {
+				t.Errorf("expected upstream headers to match; got: %q, want: %q", upstreamHeader, c.upstreamHeader)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// sendUpstreamError responds to a request that couldn't be proxied because of
+// err, telling timeouts apart from failures to reach the upstream at all.
+func sendUpstreamError(w http.ResponseWriter, r *http.Request, err error) {
+	status, code := upstreamErrorStatus(err)
+	writeError(w, r, status, apiError{
+		Code:    code,
+		Message: err.Error(),
+	})
+}
+
+// upstreamErrorStatus returns the status and error code for a request to the
+// upstream that failed with err. Timeouts are a 504 and everything else is a
+// 502, with the code saying why.
+func upstreamErrorStatus(err error) (int, string) {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return http.StatusGatewayTimeout, "upstream_timeout"
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return http.StatusBadGateway, "upstream_dns_failure"
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return http.StatusBadGateway, "upstream_connection_refused"
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return http.StatusBadGateway, "upstream_unreachable"
+	}
+	return http.StatusBadGateway, errorCode(http.StatusBadGateway)
+}
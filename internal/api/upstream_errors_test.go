@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+// roundTripperFunc lets a function be used as an http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// timeoutError is a net.Error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "unit-test: i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestProxyHandlerUpstreamErrors(t *testing.T) {
+	type testCase struct {
+		name       string
+		err        error
+		statusCode int
+		code       string
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "timeout",
+			err:        timeoutError{},
+			statusCode: http.StatusGatewayTimeout,
+			code:       "upstream_timeout",
+		},
+		testCase{
+			name:       "context deadline",
+			err:        context.DeadlineExceeded,
+			statusCode: http.StatusGatewayTimeout,
+			code:       "upstream_timeout",
+		},
+		testCase{
+			name:       "dns failure",
+			err:        &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "upstream.invalid", IsNotFound: true}},
+			statusCode: http.StatusBadGateway,
+			code:       "upstream_dns_failure",
+		},
+		testCase{
+			name:       "connection refused",
+			err:        &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)},
+			statusCode: http.StatusBadGateway,
+			code:       "upstream_connection_refused",
+		},
+		testCase{
+			name:       "connection reset",
+			err:        &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)},
+			statusCode: http.StatusBadGateway,
+			code:       "upstream_unreachable",
+		},
+		testCase{
+			name:       "other",
+			err:        errors.New("unit-test: malformed response"),
+			statusCode: http.StatusBadGateway,
+			code:       "bad_gateway",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := handler{
+				l:              log.NewNopLogger(),
+				optionProxyURL: "http://upstream.invalid",
+				proxyClient: &http.Client{
+					Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+						return nil, c.err
+					}),
+				},
+			}
+
+			rr := httptest.NewRecorder()
+			h.proxyHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/proxy", nil))
+
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.statusCode)
+			}
+
+			var resp apiError
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err.Error())
+			}
+			if resp.Code != c.code {
+				t.Errorf("expected codes to match; got: %v, want: %v", resp.Code, c.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// upstreamFailureThreshold is the number of failures in a row after which
+	// an upstream is skipped.
+	upstreamFailureThreshold = 3
+
+	// upstreamCooldown is how long a failing upstream is skipped for before
+	// it is tried again.
+	upstreamCooldown = 30 * time.Second
+)
+
+// Upstream is one replica of the upstream, which is sent a share of the proxy
+// requests in proportion to its weight.
+type Upstream struct {
+	URL    *url.URL
+	Weight int
+}
+
+// ParseUpstreams parses upstreams given as a URL with an optional weight after
+// a pipe, such as https://a.example.com|3. The weight defaults to 1.
+func ParseUpstreams(specs []string) ([]Upstream, error) {
+	upstreams := make([]Upstream, 0, len(specs))
+	for _, spec := range specs {
+		rawURL, rawWeight := spec, "1"
+		if i := strings.LastIndex(spec, "|"); i >= 0 {
+			rawURL, rawWeight = spec[:i], spec[i+1:]
+		}
+
+		u, err := url.Parse(strings.TrimSpace(rawURL))
+		if err != nil {
+			return nil, fmt.Errorf("upstream %q: %v", spec, err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("upstream %q must be an absolute URL", spec)
+		}
+
+		weight, err := strconv.Atoi(strings.TrimSpace(rawWeight))
+		if err != nil || weight < 1 {
+			return nil, fmt.Errorf("upstream %q must have a positive weight", spec)
+		}
+
+		upstreams = append(upstreams, Upstream{URL: u, Weight: weight})
+	}
+	return upstreams, nil
+}
+
+// upstreamState is the balancing and health state of one upstream.
+type upstreamState struct {
+	Upstream
+
+	// current is the upstream's running score for smooth weighted round
+	// robin.
+	current int
+
+	failures  int
+	downUntil time.Time
+}
+
+// upstreamPool spreads requests across upstreams with smooth weighted round
+// robin, so that heavier upstreams get more requests without getting them
+// all in a row. An upstream that fails upstreamFailureThreshold times in a row
+// is skipped for upstreamCooldown. When every upstream is being skipped they
+// are all tried, since sending a request somewhere beats failing it outright.
+type upstreamPool struct {
+	mutex     sync.Mutex
+	upstreams []*upstreamState
+	now       func() time.Time
+}
+
+func newUpstreamPool(upstreams []Upstream) *upstreamPool {
+	p := &upstreamPool{
+		now: time.Now,
+	}
+	for _, u := range upstreams {
+		p.upstreams = append(p.upstreams, &upstreamState{Upstream: u})
+	}
+	return p
+}
+
+// next picks the upstream to send the next request to.
+func (p *upstreamPool) next() *url.URL {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := p.now()
+	candidates := make([]*upstreamState, 0, len(p.upstreams))
+	for _, u := range p.upstreams {
+		if !now.Before(u.downUntil) {
+			candidates = append(candidates, u)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = p.upstreams
+	}
+
+	var best *upstreamState
+	total := 0
+	for _, u := range candidates {
+		u.current += u.Weight
+		total += u.Weight
+		if best == nil || u.current > best.current {
+			best = u
+		}
+	}
+	best.current -= total
+	return best.URL
+}
+
+// report records whether a request to the upstream at target succeeded.
+func (p *upstreamPool) report(target *url.URL, ok bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, u := range p.upstreams {
+		if u.URL != target {
+			continue
+		}
+
+		if ok {
+			u.failures = 0
+			return
+		}
+		u.failures++
+		if u.failures >= upstreamFailureThreshold {
+			u.downUntil = p.now().Add(upstreamCooldown)
+			u.failures = 0
+		}
+		return
+	}
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestParseUpstreams(t *testing.T) {
+	type testCase struct {
+		name    string
+		specs   []string
+		weights map[string]int
+		wantErr bool
+	}
+
+	cases := []testCase{
+		testCase{
+			name:    "default weight",
+			specs:   []string{"https://a.example.com", "https://b.example.com:8443"},
+			weights: map[string]int{"a.example.com": 1, "b.example.com:8443": 1},
+		},
+		testCase{
+			name:    "weighted",
+			specs:   []string{"https://a.example.com|3", "https://b.example.com | 1"},
+			weights: map[string]int{"a.example.com": 3, "b.example.com": 1},
+		},
+		testCase{
+			name:    "relative",
+			specs:   []string{"a.example.com|2"},
+			wantErr: true,
+		},
+		testCase{
+			name:    "zero weight",
+			specs:   []string{"https://a.example.com|0"},
+			wantErr: true,
+		},
+		testCase{
+			name:    "bad weight",
+			specs:   []string{"https://a.example.com|heavy"},
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			upstreams, err := ParseUpstreams(c.specs)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("expected error to match; got: %v, want error: %v", err, c.wantErr)
+			}
+			if c.wantErr {
+				return
+			}
+
+			weights := map[string]int{}
+			for _, u := range upstreams {
+				weights[u.URL.Host] = u.Weight
+			}
+			if !reflect.DeepEqual(weights, c.weights) {
+				t.Errorf("expected weights to match; got: %v, want: %v", weights, c.weights)
+			}
+		})
+	}
+}
+
+func TestUpstreamPoolNext(t *testing.T) {
+	upstreams, _ := ParseUpstreams([]string{"https://a.example.com|5", "https://b.example.com|2", "https://c.example.com"})
+	p := newUpstreamPool(upstreams)
+
+	counts := map[string]int{}
+	var sequence []string
+	for i := 0; i < 80; i++ {
+		host := p.next().Host
+		counts[host]++
+		if i < 8 {
+			sequence = append(sequence, host)
+		}
+	}
+
+	want := map[string]int{"a.example.com": 50, "b.example.com": 20, "c.example.com": 10}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("expected distribution to match the weights; got: %v, want: %v", counts, want)
+	}
+
+	// The heaviest upstream is interleaved with the others rather than being
+	// sent its whole share at once
+	wantSequence := []string{"a", "b", "a", "a", "c", "a", "b", "a"}
+	for i := range wantSequence {
+		wantSequence[i] += ".example.com"
+	}
+	if !reflect.DeepEqual(sequence, wantSequence) {
+		t.Errorf("expected requests to be interleaved; got: %v, want: %v", sequence, wantSequence)
+	}
+}
+
+func TestUpstreamPoolSkipsFailing(t *testing.T) {
+	upstreams, _ := ParseUpstreams([]string{"https://a.example.com", "https://b.example.com"})
+	p := newUpstreamPool(upstreams)
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	for i := 0; i < upstreamFailureThreshold; i++ {
+		p.report(upstreams[0].URL, false)
+	}
+
+	for i := 0; i < 10; i++ {
+		if host := p.next().Host; host != "b.example.com" {
+			t.Fatalf("expected the failing upstream to be skipped; got: %v", host)
+		}
+	}
+
+	// Once every upstream is failing they are all tried again
+	for i := 0; i < upstreamFailureThreshold; i++ {
+		p.report(upstreams[1].URL, false)
+	}
+	seen := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		seen[p.next().Host] = true
+	}
+	if len(seen) != 2 {
+		t.Errorf("expected every upstream to be tried when all are failing; got: %v", seen)
+	}
+
+	now = now.Add(upstreamCooldown)
+	p.report(upstreams[1].URL, true)
+	seen = map[string]bool{}
+	for i := 0; i < 4; i++ {
+		seen[p.next().Host] = true
+	}
+	if len(seen) != 2 {
+		t.Errorf("expected the upstreams to be tried again after the cooldown; got: %v", seen)
+	}
+}
+
+func TestProxyHandlerUpstreams(t *testing.T) {
+	hits := map[string]int{}
+	newUpstream := func(name string, status int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[name+" "+r.URL.Path]++
+			w.WriteHeader(status)
+		}))
+	}
+	healthy := newUpstream("healthy", http.StatusOK)
+	defer healthy.Close()
+	failing := newUpstream("failing", http.StatusInternalServerError)
+	defer failing.Close()
+
+	upstreams, err := ParseUpstreams([]string{healthy.URL, failing.URL})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	h := handler{
+		l:              log.NewNopLogger(),
+		optionProxyURL: "https://upstream.example.com/v1/webhooks",
+		upstreams:      newUpstreamPool(upstreams),
+	}
+
+	for i := 0; i < 20; i++ {
+		h.proxyHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/proxy", nil))
+	}
+
+	want := map[string]int{
+		"failing /v1/webhooks": upstreamFailureThreshold,
+		"healthy /v1/webhooks": 20 - upstreamFailureThreshold,
+	}
+	if !reflect.DeepEqual(hits, want) {
+		t.Errorf("expected the failing upstream to be skipped once it kept failing; got: %v, want: %v", hits, want)
+	}
+}
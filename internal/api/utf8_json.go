@@ -0,0 +1,54 @@
+package api
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// utf8BOM is the byte order mark some clients put at the start of UTF-8 text,
+// which isn't allowed in JSON.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// withUTF8JSON strips a leading byte order mark from JSON request bodies and
+// responds with a 400 when they aren't valid UTF-8, rather than leaving the
+// upstream's JSON parser to fail on them. Bodies of other content types are
+// left alone, and JSON bodies over max bytes are rejected with a 413.
+func withUTF8JSON(next http.Handler, max int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isJSON(r.Header.Get("Content-Type")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		b, ok := bufferBody(w, r, max)
+		if !ok {
+			return
+		}
+
+		b = bytes.TrimPrefix(b, utf8BOM)
+		if !utf8.Valid(b) {
+			sendValidationErrors(w, r, []errorValidation{
+				errorValidation{Field: "body", Reason: "must be valid UTF-8"},
+			})
+			return
+		}
+
+		r.Body = ioutil.NopCloser(bytes.NewReader(b))
+		r.ContentLength = int64(len(b))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isJSON reports whether contentType is application/json or a JSON based type
+// like application/problem+json.
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithUTF8JSON(t *testing.T) {
+	type testCase struct {
+		name        string
+		contentType string
+		body        []byte
+		statusCode  int
+		want        []byte
+	}
+
+	cases := []testCase{
+		testCase{
+			name:        "valid",
+			contentType: "application/json",
+			body:        []byte(`{"name":"Zoë"}`),
+			statusCode:  http.StatusOK,
+			want:        []byte(`{"name":"Zoë"}`),
+		},
+		testCase{
+			name:        "byte order mark",
+			contentType: "application/json; charset=utf-8",
+			body:        append([]byte{0xEF, 0xBB, 0xBF}, `{"unit":"test"}`...),
+			statusCode:  http.StatusOK,
+			want:        []byte(`{"unit":"test"}`),
+		},
+		testCase{
+			name:        "invalid bytes",
+			contentType: "application/json",
+			body:        []byte{'{', '"', 0xC3, 0x28, '"', ':', '1', '}'},
+			statusCode:  http.StatusBadRequest,
+		},
+		testCase{
+			name:        "invalid bytes in a json based type",
+			contentType: "application/vnd.api+json",
+			body:        []byte{'"', 0xFF, '"'},
+			statusCode:  http.StatusBadRequest,
+		},
+		testCase{
+			name:        "not json",
+			contentType: "application/octet-stream",
+			body:        []byte{0xEF, 0xBB, 0xBF, 0xFF},
+			statusCode:  http.StatusOK,
+			want:        []byte{0xEF, 0xBB, 0xBF, 0xFF},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got []byte
+			var contentLength int64
+			h := withUTF8JSON(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = ioutil.ReadAll(r.Body)
+				contentLength = r.ContentLength
+			}), 0)
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/proxy", bytes.NewReader(c.body))
+			r.Header.Set("Content-Type", c.contentType)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", w.Code, c.statusCode)
+			}
+			if c.statusCode != http.StatusOK {
+				return
+			}
+			if !bytes.Equal(got, c.want) {
+				t.Errorf("expected bodies to match; got: %q, want: %q", got, c.want)
+			}
+			if contentLength != int64(len(c.want)) {
+				t.Errorf("expected content lengths to match; got: %v, want %v", contentLength, len(c.want))
+			}
+		})
+	}
+}
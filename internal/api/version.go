@@ -0,0 +1,29 @@
+package api
+
+import (
+	"context"
+	"net/http"
+)
+
+const contextKeyVersion contextKey = "version"
+
+// versionHeader is the response header that carries the deployed build.
+const versionHeader = "X-App-Version"
+
+// versionFromContext returns the version stored by withVersion.
+func versionFromContext(ctx context.Context) (string, bool) {
+	version, ok := ctx.Value(contextKeyVersion).(string)
+	return version, ok && version != ""
+}
+
+// withVersion sets the X-App-Version header on every response, and stores
+// version in the request context so that it can be logged, so that issues
+// reported by clients can be tied to the build that served them.
+func withVersion(next http.Handler, version string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(versionHeader, version)
+
+		ctx := context.WithValue(r.Context(), contextKeyVersion, version)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithVersion(t *testing.T) {
+	var version string
+	h := withVersion(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version, _ = versionFromContext(r.Context())
+		w.WriteHeader(http.StatusNotFound)
+	}), "1.2.3")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	if got := w.Header().Get("X-App-Version"); got != "1.2.3" {
+		t.Errorf("expected version header to match; got: %q, want: %q", got, "1.2.3")
+	}
+	if version != "1.2.3" {
+		t.Errorf("expected version in context to match; got: %q, want: %q", version, "1.2.3")
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"context"
+	"net/http"
+)
+
+const contextKeyWriteKey contextKey = "write-key"
+
+// writeKeyFromContext returns the write key validated by withBasicWriteKey.
+func writeKeyFromContext(ctx context.Context) (string, bool) {
+	writeKey, ok := ctx.Value(contextKeyWriteKey).(string)
+	return writeKey, ok
+}
+
+// withBasicWriteKey requires the basic auth username on every request to be a
+// write key accepted by validate, responding with a 401 otherwise. The write key
+// is stored in the request context for anything further down the chain.
+func withBasicWriteKey(next http.Handler, validate func(key string) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeKey, _, ok := r.BasicAuth()
+		if !ok || writeKey == "" || !validate(writeKey) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="write key"`)
+			sendError(w, r, http.StatusUnauthorized, "a valid write key is required")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), contextKeyWriteKey, writeKey)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// writeKeyValidator accepts only the given write keys.
+func writeKeyValidator(keys []string) func(string) bool {
+	valid := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		valid[key] = true
+	}
+
+	return func(key string) bool {
+		return valid[key]
+	}
+}
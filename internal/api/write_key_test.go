@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithBasicWriteKey(t *testing.T) {
+	type testCase struct {
+		name       string
+		writeKey   string
+		basicAuth  bool
+		statusCode int
+	}
+
+	cases := []testCase{
+		testCase{
+			name:       "valid write key",
+			writeKey:   "valid-key",
+			basicAuth:  true,
+			statusCode: http.StatusOK,
+		},
+		testCase{
+			name:       "invalid write key",
+			writeKey:   "invalid-key",
+			basicAuth:  true,
+			statusCode: http.StatusUnauthorized,
+		},
+		testCase{
+			name:       "empty write key",
+			basicAuth:  true,
+			statusCode: http.StatusUnauthorized,
+		},
+		testCase{
+			name:       "missing credentials",
+			statusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var writeKey string
+			h := withBasicWriteKey(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				writeKey, _ = writeKeyFromContext(r.Context())
+			}), writeKeyValidator([]string{"valid-key"}))
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/proxy", nil)
+			if c.basicAuth {
+				r.SetBasicAuth(c.writeKey, "")
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			if rr.Code != c.statusCode {
+				t.Errorf("expected status codes to match; got: %v, want %v", rr.Code, c.statusCode)
+			}
+
+			if c.statusCode == http.StatusOK {
+				if writeKey != c.writeKey {
+					t.Errorf("expected write key in context; got: %q, want: %q", writeKey, c.writeKey)
+				}
+				return
+			}
+			if got := rr.Header().Get("WWW-Authenticate"); got != `Basic realm="write key"` {
+				t.Errorf("expected a basic auth challenge; got: %q", got)
+			}
+		})
+	}
+}